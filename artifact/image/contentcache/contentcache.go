@@ -0,0 +1,125 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package contentcache provides a content-addressed cache of extraction results for layer
+// scanning, so that re-running extractors against a file whose content is unchanged across
+// chain layers (a very common case for base-image files) can be skipped entirely.
+package contentcache
+
+import (
+	"path"
+	"sync"
+
+	iradix "github.com/hashicorp/go-immutable-radix"
+
+	"github.com/google/osv-scalibr/extractor"
+)
+
+// FileEntry is the cached state for one path within a layer.
+type FileEntry struct {
+	// HeaderDigest is the SHA-256 of a directory's listing metadata (each child's name with its
+	// size and mtime, or a subdirectory's own HeaderDigest). It is only set for directory entries;
+	// single-file entries leave it zero and are validated by ContentDigest alone.
+	HeaderDigest [32]byte
+	// ContentDigest is the SHA-256 of the file blob. For directories, it is the combined digest
+	// of the recursive contents of the subtree rather than any single blob, so that an entire
+	// unchanged subtree can be reused without walking it again.
+	ContentDigest [32]byte
+	// Inventory maps extractor name to the inventory it produced the last time it ran against
+	// this exact content digest.
+	Inventory map[string][]*extractor.Inventory
+}
+
+// CacheContext is the cache for a single OCI layer (keyed by DiffID at the Manager level),
+// indexed by cleaned absolute path within that layer. It is backed by an immutable radix tree so
+// that looking up a path is cheap and the tree can be shared/read concurrently across goroutines
+// scanning different layers of the same image.
+type CacheContext struct {
+	tree *iradix.Tree
+}
+
+// newCacheContext returns an empty CacheContext.
+func newCacheContext() *CacheContext {
+	return &CacheContext{tree: iradix.New()}
+}
+
+// Lookup returns the cached entry for cleanPath, if any.
+func (c *CacheContext) Lookup(cleanPath string) (*FileEntry, bool) {
+	if c == nil {
+		return nil, false
+	}
+
+	v, ok := c.tree.Get(radixKey(cleanPath))
+	if !ok {
+		return nil, false
+	}
+	return v.(*FileEntry), true
+}
+
+// Insert returns a new CacheContext with entry recorded for cleanPath. CacheContext is
+// immutable: Insert never mutates the receiver, so a CacheContext returned by Manager.GetCacheContext
+// can safely be read from other goroutines while a new version is being built.
+func (c *CacheContext) Insert(cleanPath string, entry *FileEntry) *CacheContext {
+	tree := c.tree
+	if tree == nil {
+		tree = iradix.New()
+	}
+	newTree, _, _ := tree.Insert(radixKey(cleanPath), entry)
+	return &CacheContext{tree: newTree}
+}
+
+// radixKey converts a filesystem path into the byte-slice key go-immutable-radix expects,
+// cleaning it first so that equivalent paths (e.g. "/a/b" and "/a/b/") share a cache entry.
+func radixKey(p string) []byte {
+	return []byte(path.Clean("/" + p))
+}
+
+// Manager owns one CacheContext per OCI layer DiffID, so that callers scanning many related
+// images (e.g. a registry sweep of a family of images sharing a base) can reuse extraction
+// results for the layers they have in common. A Manager is safe for concurrent use by multiple
+// goroutines, since a layer-scanning trace may extract several locations of the same layer in
+// parallel.
+type Manager struct {
+	mu       sync.Mutex
+	contexts map[string]*CacheContext
+}
+
+// NewManager creates an empty Manager.
+func NewManager() *Manager {
+	return &Manager{contexts: make(map[string]*CacheContext)}
+}
+
+// GetCacheContext returns the CacheContext for diffID, creating an empty one if this is the
+// first time it has been seen.
+func (m *Manager) GetCacheContext(diffID string) *CacheContext {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if cc, ok := m.contexts[diffID]; ok {
+		return cc
+	}
+
+	cc := newCacheContext()
+	m.contexts[diffID] = cc
+	return cc
+}
+
+// SetCacheContext replaces the CacheContext stored for diffID, typically with the result of one
+// or more CacheContext.Insert calls made while processing that layer.
+func (m *Manager) SetCacheContext(diffID string, cc *CacheContext) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.contexts[diffID] = cc
+}
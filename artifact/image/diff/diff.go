@@ -0,0 +1,181 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package diff produces a structured package-level diff between two scans of related container
+// images (e.g. successive tags of the same image), built on top of the per-package LayerDetails
+// populated by the trace package.
+package diff
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/google/osv-scalibr/extractor"
+)
+
+// ChangeKind describes how a package changed between the first and second scan.
+type ChangeKind int
+
+const (
+	// Unchanged means the package is present, at the same version, in both scans.
+	Unchanged ChangeKind = iota
+	// Added means the package is only present in the second scan.
+	Added
+	// Removed means the package is only present in the first scan.
+	Removed
+	// VersionChanged means the package is present in both scans at different versions.
+	VersionChanged
+	// LayerMoved means the package is unchanged but was introduced by a different layer
+	// (different origin DiffID or Command) between the two scans.
+	LayerMoved
+)
+
+// String returns a human-readable name for k.
+func (k ChangeKind) String() string {
+	switch k {
+	case Unchanged:
+		return "unchanged"
+	case Added:
+		return "added"
+	case Removed:
+		return "removed"
+	case VersionChanged:
+		return "version-changed"
+	case LayerMoved:
+		return "layer-moved"
+	default:
+		return "unknown"
+	}
+}
+
+// PackagePair pairs up the same logical package across two scans. Exactly one of First or Second
+// is nil when Change is Added or Removed.
+type PackagePair struct {
+	First  *extractor.Inventory
+	Second *extractor.Inventory
+	Change ChangeKind
+}
+
+// packageKey returns the key used to match the same logical package across the two scans: the
+// package's PURL, falling back to "name|ecosystem" when no PURL can be computed (e.g. for
+// extractors that don't support PURLs).
+func packageKey(inv *extractor.Inventory) string {
+	if p := inv.Extractor.ToPURL(inv); p != nil {
+		return p.String()
+	}
+	return fmt.Sprintf("%s|%s", inv.Name, inv.Extractor.Ecosystem(inv))
+}
+
+// PackagePairs is a diff result: one PackagePair per distinct package across the two scans.
+type PackagePairs []*PackagePair
+
+// Diff compares first and second, two []*extractor.Inventory results from scanning related
+// images, and returns one PackagePair per distinct package across both scans.
+func Diff(first, second []*extractor.Inventory) PackagePairs {
+	firstByKey := make(map[string]*extractor.Inventory, len(first))
+	for _, inv := range first {
+		firstByKey[packageKey(inv)] = inv
+	}
+
+	secondByKey := make(map[string]*extractor.Inventory, len(second))
+	for _, inv := range second {
+		secondByKey[packageKey(inv)] = inv
+	}
+
+	var pairs PackagePairs
+	for key, firstInv := range firstByKey {
+		secondInv, ok := secondByKey[key]
+		if !ok {
+			pairs = append(pairs, &PackagePair{First: firstInv, Change: Removed})
+			continue
+		}
+		pairs = append(pairs, &PackagePair{First: firstInv, Second: secondInv, Change: changeKind(firstInv, secondInv)})
+	}
+
+	for key, secondInv := range secondByKey {
+		if _, ok := firstByKey[key]; !ok {
+			pairs = append(pairs, &PackagePair{Second: secondInv, Change: Added})
+		}
+	}
+
+	return pairs
+}
+
+// changeKind classifies the difference between the same logical package as seen in two scans.
+func changeKind(first, second *extractor.Inventory) ChangeKind {
+	if first.Version != second.Version {
+		return VersionChanged
+	}
+
+	if layerMoved(first.LayerDetails, second.LayerDetails) {
+		return LayerMoved
+	}
+
+	return Unchanged
+}
+
+// layerMoved reports whether a and b refer to different origin layers, treating a nil
+// LayerDetails (origin not traced) as equal to any other nil.
+func layerMoved(a, b *extractor.LayerDetails) bool {
+	if a == nil || b == nil {
+		return a != b
+	}
+	return a.DiffID != b.DiffID || a.Command != b.Command
+}
+
+// Report is the result of grouping a PackagePairs diff by originating layer command.
+type Report struct {
+	// ByCommand maps a layer Command string to the package pairs it introduced or changed.
+	ByCommand map[string][]*PackagePair
+	// Unattributed holds pairs whose attributed side (Second, or First for Removed pairs) has no
+	// resolved origin layer (e.g. LayerDetails was never populated via the trace package).
+	Unattributed []*PackagePair
+}
+
+// Report groups pairs by originating layer command, so users can see e.g. "three CVE-bearing
+// packages were introduced by `RUN apt-get install ...` in layer diff-id-4".
+func (pairs PackagePairs) Report() *Report {
+	report := &Report{ByCommand: make(map[string][]*PackagePair)}
+
+	for _, pair := range pairs {
+		if pair.Change == Unchanged {
+			continue
+		}
+
+		details := pair.Second
+		if details == nil {
+			details = pair.First
+		}
+
+		if details == nil || details.LayerDetails == nil {
+			report.Unattributed = append(report.Unattributed, pair)
+			continue
+		}
+
+		command := details.LayerDetails.Command
+		report.ByCommand[command] = append(report.ByCommand[command], pair)
+	}
+
+	return report
+}
+
+// Commands returns the layer commands present in the report, sorted for stable output.
+func (r *Report) Commands() []string {
+	commands := make([]string, 0, len(r.ByCommand))
+	for command := range r.ByCommand {
+		commands = append(commands, command)
+	}
+	sort.Strings(commands)
+	return commands
+}
@@ -0,0 +1,91 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package diff
+
+import (
+	"testing"
+
+	"github.com/google/osv-scalibr/extractor"
+	"github.com/google/osv-scalibr/testing/fakeextractor"
+)
+
+func TestDiff(t *testing.T) {
+	fakeExtractor := fakeextractor.New("fake-extractor", 1, nil, nil)
+
+	unchanged := &extractor.Inventory{Name: "foo", Version: "1.0", Extractor: fakeExtractor}
+	removed := &extractor.Inventory{Name: "bar", Version: "1.0", Extractor: fakeExtractor}
+	added := &extractor.Inventory{Name: "baz", Version: "1.0", Extractor: fakeExtractor}
+	changedOld := &extractor.Inventory{Name: "qux", Version: "1.0", Extractor: fakeExtractor}
+	changedNew := &extractor.Inventory{Name: "qux", Version: "2.0", Extractor: fakeExtractor}
+
+	first := []*extractor.Inventory{unchanged, removed, changedOld}
+	second := []*extractor.Inventory{unchanged, added, changedNew}
+
+	got := Diff(first, second)
+
+	wantChanges := map[string]ChangeKind{
+		"foo": Unchanged,
+		"bar": Removed,
+		"baz": Added,
+		"qux": VersionChanged,
+	}
+
+	if len(got) != len(wantChanges) {
+		t.Fatalf("Diff(%v, %v) returned %d pairs, want %d", first, second, len(got), len(wantChanges))
+	}
+
+	for _, pair := range got {
+		name := pair.Second
+		if name == nil {
+			name = pair.First
+		}
+		want, ok := wantChanges[name.Name]
+		if !ok {
+			t.Errorf("Diff(...) returned unexpected package %q", name.Name)
+			continue
+		}
+		if pair.Change != want {
+			t.Errorf("Diff(...) package %q got change %v, want %v", name.Name, pair.Change, want)
+		}
+	}
+}
+
+func TestReport(t *testing.T) {
+	fakeExtractor := fakeextractor.New("fake-extractor", 1, nil, nil)
+
+	added := &extractor.Inventory{
+		Name:      "baz",
+		Version:   "1.0",
+		Extractor: fakeExtractor,
+		LayerDetails: &extractor.LayerDetails{
+			DiffID:  "diff-id-2",
+			Command: "RUN apt-get install baz",
+		},
+	}
+
+	pairs := PackagePairs{
+		{Second: added, Change: Added},
+	}
+
+	report := pairs.Report()
+
+	const command = "RUN apt-get install baz"
+	if len(report.ByCommand[command]) != 1 {
+		t.Errorf("Report().ByCommand[%q] = %v, want 1 entry", command, report.ByCommand[command])
+	}
+	if len(report.Unattributed) != 0 {
+		t.Errorf("Report().Unattributed = %v, want empty", report.Unattributed)
+	}
+}
@@ -0,0 +1,49 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package image defines the container image layer abstractions that layer scanning is built on:
+// a single OCI Layer, and a ChainLayer pairing a Layer with the squashed filesystem view of the
+// image up to and including it.
+package image
+
+import (
+	scalibrfs "github.com/google/osv-scalibr/fs"
+)
+
+// Layer is a single OCI image layer.
+type Layer interface {
+	// DiffID is the layer's content hash.
+	DiffID() string
+	// Command is the build-history command that produced this layer (e.g. a Dockerfile RUN
+	// line), or "" if unknown.
+	Command() string
+	// FileDiff returns the paths this layer's own tar touched, relative to the image root:
+	// added or modified paths verbatim, and removed paths (including OCI whiteouts) prefixed
+	// with the reserved ".wh." marker, mirroring the OCI image spec's own whiteout convention.
+	// ok is false when this layer doesn't know its own diff (e.g. it was reconstructed only as
+	// a squashed filesystem with no tar available) -- callers must then not assume anything
+	// about what changed and fall back to a full comparison.
+	FileDiff() (paths []string, ok bool)
+}
+
+// ChainLayer is one layer of an image plus the cumulative (squashed) filesystem view of the
+// image up to and including that layer.
+type ChainLayer interface {
+	// Layer is this chain layer's own (non-cumulative) layer.
+	Layer() Layer
+	// FS is the squashed filesystem view of the image up to and including this layer.
+	FS() scalibrfs.FS
+	// Index is this chain layer's 0-based position among the image's chain layers, oldest first.
+	Index() int
+}
@@ -0,0 +1,67 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fakechainlayer provides an image.ChainLayer fake for tests, backed by real files
+// written to a temporary directory so that extractors can open and stat them like any other
+// filesystem.
+package fakechainlayer
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	scalibrImage "github.com/google/osv-scalibr/artifact/image"
+	"github.com/google/osv-scalibr/artifact/image/layerscanning/testing/fakelayer"
+	scalibrfs "github.com/google/osv-scalibr/fs"
+)
+
+// FakeChainLayer is a fake image.ChainLayer whose squashed filesystem is a real directory on
+// disk, populated from a fixed set of file contents.
+type FakeChainLayer struct {
+	index int
+	layer *fakelayer.FakeLayer
+	fsys  scalibrfs.FS
+}
+
+// New writes fileContents (path -> content) under testDir and returns a FakeChainLayer whose FS
+// is rooted there, reporting index as its chain layer position and layer as its own (non-
+// cumulative) layer. fileContents should be the cumulative file state at this chain layer, i.e.
+// the squashed view, mirroring what image.ChainLayer.FS documents.
+func New(testDir string, index int, diffID, command string, layer *fakelayer.FakeLayer, fileContents map[string]string) (*FakeChainLayer, error) {
+	for name, content := range fileContents {
+		fullPath := filepath.Join(testDir, name)
+		if err := os.MkdirAll(filepath.Dir(fullPath), 0o755); err != nil {
+			return nil, fmt.Errorf("creating directory for %q: %w", name, err)
+		}
+		if err := os.WriteFile(fullPath, []byte(content), 0o644); err != nil {
+			return nil, fmt.Errorf("writing %q: %w", name, err)
+		}
+	}
+
+	return &FakeChainLayer{
+		index: index,
+		layer: layer,
+		fsys:  os.DirFS(testDir).(scalibrfs.FS),
+	}, nil
+}
+
+// Layer implements image.ChainLayer.
+func (c *FakeChainLayer) Layer() scalibrImage.Layer { return c.layer }
+
+// FS implements image.ChainLayer.
+func (c *FakeChainLayer) FS() scalibrfs.FS { return c.fsys }
+
+// Index implements image.ChainLayer.
+func (c *FakeChainLayer) Index() int { return c.index }
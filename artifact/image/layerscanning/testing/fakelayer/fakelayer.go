@@ -0,0 +1,47 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fakelayer provides an image.Layer fake for tests.
+package fakelayer
+
+// FakeLayer is a fake image.Layer.
+type FakeLayer struct {
+	diffID   string
+	command  string
+	ownFiles []string
+	hasDiff  bool
+}
+
+// New returns a fake Layer with the given DiffID and history Command.
+//
+// ownFiles, if provided, is this layer's own tar diff, in the format image.Layer.FileDiff
+// documents (paths added/modified verbatim, removed paths prefixed with ".wh."); FileDiff then
+// reports ok=true. Callers that don't pass ownFiles get a layer whose FileDiff reports ok=false,
+// meaning "this fixture doesn't model per-layer diff data" rather than "nothing changed" -- most
+// existing fixtures predate per-layer diff tracking and rely on the squashed-filesystem fallback
+// instead.
+func New(diffID, command string, ownFiles ...string) *FakeLayer {
+	return &FakeLayer{diffID: diffID, command: command, ownFiles: ownFiles, hasDiff: len(ownFiles) > 0}
+}
+
+// DiffID implements image.Layer.
+func (l *FakeLayer) DiffID() string { return l.diffID }
+
+// Command implements image.Layer.
+func (l *FakeLayer) Command() string { return l.command }
+
+// FileDiff implements image.Layer.
+func (l *FakeLayer) FileDiff() ([]string, bool) {
+	return l.ownFiles, l.hasDiff
+}
@@ -0,0 +1,113 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trace
+
+import (
+	"encoding/json"
+	"io"
+
+	scalibrImage "github.com/google/osv-scalibr/artifact/image"
+	"github.com/google/osv-scalibr/extractor/filesystem"
+)
+
+// BaseImageMatcher identifies the prefix of a chain layer list that corresponds to a known base
+// image (e.g. Alpine, Debian, distroless, UBI), so vulnerabilities inherited from the base can be
+// distinguished from ones introduced by the image's own build steps. It's an alias of
+// filesystem.BaseImageMatcher (defined there instead of here to avoid a filesystem<->trace import
+// cycle, since filesystem.Config needs to reference it).
+type BaseImageMatcher = filesystem.BaseImageMatcher
+
+// knownBaseImage is one entry of a base image manifest: an ordered list of the DiffIDs a known
+// base image's layers have, from oldest to newest, plus the history commands (Dockerfile
+// "#(nop)"/Author/Comment strings) those same layers were built with.
+type knownBaseImage struct {
+	Ref     string   `json:"ref"`
+	DiffIDs []string `json:"diff_ids"`
+	// History is each layer's build-history command (image.Layer.Command()), oldest first. It's
+	// an additional signal alongside DiffIDs: a base image repacked or rebuilt reproducibly
+	// (e.g. by a from-scratch mirror) commonly keeps the same history strings even though the
+	// resulting layer content, and so its DiffIDs, changed.
+	History []string `json:"history"`
+}
+
+// manifestBaseImageMatcher matches chain layers against a fixed set of known base image DiffID
+// and history chains, loaded from a JSON manifest.
+//
+//	[
+//	  {"ref": "alpine:3.19", "diff_ids": ["sha256:...", "sha256:..."], "history": ["#(nop) ADD file:... in / "]},
+//	  {"ref": "debian:12",   "diff_ids": ["sha256:...", "sha256:..."]}
+//	]
+type manifestBaseImageMatcher struct {
+	bases []knownBaseImage
+}
+
+// NewManifestBaseImageMatcher loads a BaseImageMatcher from a JSON manifest of known base image
+// DiffID chains, in the format documented on manifestBaseImageMatcher.
+func NewManifestBaseImageMatcher(r io.Reader) (BaseImageMatcher, error) {
+	var bases []knownBaseImage
+	if err := json.NewDecoder(r).Decode(&bases); err != nil {
+		return nil, err
+	}
+	return &manifestBaseImageMatcher{bases: bases}, nil
+}
+
+// Match implements BaseImageMatcher by finding the known base whose DiffID chain, or history
+// chain, is the longest prefix match of chainLayers -- whichever signal matches more layers for
+// that base. Falling back to history lets a base image that was repacked or rebuilt (different
+// DiffIDs, same build commands) still be recognized.
+func (m *manifestBaseImageMatcher) Match(chainLayers []scalibrImage.ChainLayer) (int, string) {
+	bestLen := 0
+	bestRef := ""
+
+	for _, base := range m.bases {
+		n := prefixMatchLen(chainLayers, base.DiffIDs)
+		if histLen := historyPrefixMatchLen(chainLayers, base.History); histLen > n {
+			n = histLen
+		}
+		if n > bestLen {
+			bestLen = n
+			bestRef = base.Ref
+		}
+	}
+
+	return bestLen, bestRef
+}
+
+// prefixMatchLen returns how many leading chain layers have DiffIDs matching diffIDs, in order.
+func prefixMatchLen(chainLayers []scalibrImage.ChainLayer, diffIDs []string) int {
+	n := 0
+	for n < len(chainLayers) && n < len(diffIDs) {
+		if chainLayers[n].Layer().DiffID() != diffIDs[n] {
+			break
+		}
+		n++
+	}
+	return n
+}
+
+// historyPrefixMatchLen returns how many leading chain layers have build-history commands
+// matching history, in order. Layers with an empty (unknown) Command() never match, since an
+// unknown command is not evidence of anything.
+func historyPrefixMatchLen(chainLayers []scalibrImage.ChainLayer, history []string) int {
+	n := 0
+	for n < len(chainLayers) && n < len(history) {
+		command := chainLayers[n].Layer().Command()
+		if command == "" || command != history[n] {
+			break
+		}
+		n++
+	}
+	return n
+}
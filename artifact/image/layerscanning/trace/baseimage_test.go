@@ -0,0 +1,101 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trace
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/osv-scalibr/artifact/image"
+)
+
+func TestManifestBaseImageMatcher(t *testing.T) {
+	const manifest = `[
+		{"ref": "alpine:3.19", "diff_ids": ["diff-id-1", "diff-id-2"]}
+	]`
+
+	matcher, err := NewManifestBaseImageMatcher(strings.NewReader(manifest))
+	if err != nil {
+		t.Fatalf("NewManifestBaseImageMatcher(...) returned an error: %v", err)
+	}
+
+	fakeChainLayer1 := setupFakeChainLayer(t, t.TempDir(), 0, "diff-id-1", "command-1", map[string]string{"foo.txt": "foo"})
+	fakeChainLayer2 := setupFakeChainLayer(t, t.TempDir(), 1, "diff-id-2", "command-2", map[string]string{"foo.txt": "foo"})
+	fakeChainLayer3 := setupFakeChainLayer(t, t.TempDir(), 2, "diff-id-3", "command-3", map[string]string{"bar.txt": "bar"})
+
+	chainLayers := []image.ChainLayer{fakeChainLayer1, fakeChainLayer2, fakeChainLayer3}
+
+	prefixLen, ref := matcher.Match(chainLayers)
+	if prefixLen != 2 {
+		t.Errorf("Match(%v) returned prefixLen %d, want 2", chainLayers, prefixLen)
+	}
+	if ref != "alpine:3.19" {
+		t.Errorf("Match(%v) returned ref %q, want %q", chainLayers, ref, "alpine:3.19")
+	}
+}
+
+// TestManifestBaseImageMatcherFallsBackToHistory checks that a base image rebuilt from the same
+// Dockerfile instructions, but producing different layer content (and so different DiffIDs), is
+// still recognized via its history commands.
+func TestManifestBaseImageMatcherFallsBackToHistory(t *testing.T) {
+	const manifest = `[
+		{
+			"ref": "alpine:3.19",
+			"diff_ids": ["original-diff-id-1", "original-diff-id-2"],
+			"history": ["#(nop) ADD file:abc123 in / ", "#(nop) CMD [\"/bin/sh\"]"]
+		}
+	]`
+
+	matcher, err := NewManifestBaseImageMatcher(strings.NewReader(manifest))
+	if err != nil {
+		t.Fatalf("NewManifestBaseImageMatcher(...) returned an error: %v", err)
+	}
+
+	// Same history commands as the manifest, but rebuilt with different DiffIDs.
+	fakeChainLayer1 := setupFakeChainLayer(t, t.TempDir(), 0, "rebuilt-diff-id-1", `#(nop) ADD file:abc123 in / `, map[string]string{"foo.txt": "foo"})
+	fakeChainLayer2 := setupFakeChainLayer(t, t.TempDir(), 1, "rebuilt-diff-id-2", `#(nop) CMD ["/bin/sh"]`, map[string]string{"foo.txt": "foo"})
+	fakeChainLayer3 := setupFakeChainLayer(t, t.TempDir(), 2, "diff-id-3", "command-3", map[string]string{"bar.txt": "bar"})
+
+	chainLayers := []image.ChainLayer{fakeChainLayer1, fakeChainLayer2, fakeChainLayer3}
+
+	prefixLen, ref := matcher.Match(chainLayers)
+	if prefixLen != 2 {
+		t.Errorf("Match(%v) returned prefixLen %d, want 2", chainLayers, prefixLen)
+	}
+	if ref != "alpine:3.19" {
+		t.Errorf("Match(%v) returned ref %q, want %q", chainLayers, ref, "alpine:3.19")
+	}
+}
+
+// TestManifestBaseImageMatcherIgnoresEmptyHistory checks that layers with no known build command
+// (Command() == "") are never treated as a history match, since an unknown command is not
+// evidence either way.
+func TestManifestBaseImageMatcherIgnoresEmptyHistory(t *testing.T) {
+	const manifest = `[
+		{"ref": "alpine:3.19", "diff_ids": ["original-diff-id-1"], "history": [""]}
+	]`
+
+	matcher, err := NewManifestBaseImageMatcher(strings.NewReader(manifest))
+	if err != nil {
+		t.Fatalf("NewManifestBaseImageMatcher(...) returned an error: %v", err)
+	}
+
+	fakeChainLayer1 := setupFakeChainLayer(t, t.TempDir(), 0, "rebuilt-diff-id-1", "", map[string]string{"foo.txt": "foo"})
+
+	prefixLen, _ := matcher.Match([]image.ChainLayer{fakeChainLayer1})
+	if prefixLen != 0 {
+		t.Errorf("Match(...) returned prefixLen %d, want 0: an empty Command() must not match", prefixLen)
+	}
+}
@@ -0,0 +1,324 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trace
+
+import (
+	"container/list"
+	"context"
+	"sort"
+	"strings"
+	"sync"
+
+	scalibrImage "github.com/google/osv-scalibr/artifact/image"
+	"github.com/google/osv-scalibr/extractor"
+	"github.com/google/osv-scalibr/extractor/filesystem"
+)
+
+// defaultLayerPresenceCacheSize bounds how many (layer, group) presence results
+// layerPresenceCache keeps around when config.TraceConcurrency lets many groups be probed
+// in flight at once.
+const defaultLayerPresenceCacheSize = 256
+
+// OriginResult is one inventory item's resolved origin layer, as streamed from
+// ResolveOriginLayerStream.
+type OriginResult struct {
+	Key     extractor.InventoryKey
+	Details *extractor.LayerDetails
+}
+
+// ResolveOriginLayerStream traces the origin of each inventory item the same way ResolveOriginLayer
+// does, but streams each result on the returned channel as soon as it is resolved, instead of
+// waiting for every item to finish, and traces multiple inventory items concurrently.
+//
+// Inventory items that share both their Extractor and their set of Locations are traced together
+// as a single group, so the underlying extractor only runs once per layer for the whole group no
+// matter how many inventory items fall out of it; items within a group can still resolve to
+// different origin layers (e.g. if a shared manifest file is modified to drop just one of
+// several packages it lists). The number of groups traced at once is bounded by
+// config.TraceConcurrency (a value of 0 or less means no concurrency, i.e. one group at a time).
+//
+// Both channels are closed once every group has been traced or ctx is done, whichever comes
+// first. A group whose trace fails is skipped and the remaining groups are still traced; the
+// error channel is buffered and carries at most the first such error, so sending it never blocks.
+// Callers must keep receiving from the results channel until it is closed (or cancel ctx), since
+// workers block on sending each result.
+func ResolveOriginLayerStream(ctx context.Context, inventory []*extractor.Inventory, chainLayers []scalibrImage.ChainLayer, config *filesystem.Config) (<-chan OriginResult, <-chan error) {
+	results := make(chan OriginResult)
+	errs := make(chan error, 1)
+
+	groups := groupInventory(inventory)
+
+	go func() {
+		defer close(errs)
+		defer close(results)
+
+		if len(chainLayers) == 0 || len(groups) == 0 {
+			return
+		}
+
+		buildDetails := layerDetailsBuilder(chainLayers, config)
+
+		layerToDiffID := make(map[int]string, len(chainLayers))
+		for i, chainLayer := range chainLayers {
+			layerToDiffID[i] = chainLayer.Layer().DiffID()
+		}
+
+		// Precompute which paths changed between each pair of adjacent chain layers once, up front,
+		// and share it across every worker: this is the same optimization ResolveOriginLayer always
+		// applied, now amortized across the whole group pool instead of being recomputed per item.
+		layerChanges, err := computeLayerChanges(ctx, chainLayers)
+		if err != nil {
+			layerChanges = nil
+		}
+
+		presenceCache := newLayerPresenceCache(defaultLayerPresenceCacheSize)
+		lastLayerIndex := chainLayers[len(chainLayers)-1].Index()
+
+		concurrency := config.TraceConcurrency
+		if concurrency < 1 {
+			concurrency = 1
+		}
+
+		groupCh := make(chan *inventoryGroup)
+		var wg sync.WaitGroup
+		var firstErr error
+		var errOnce sync.Once
+
+		for w := 0; w < concurrency; w++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for group := range groupCh {
+					origins, err := resolveGroupOrigins(ctx, group, chainLayers, layerToDiffID, config, layerChanges, presenceCache, lastLayerIndex)
+					if err != nil {
+						errOnce.Do(func() { firstErr = err })
+						continue
+					}
+
+					for key, originIndex := range origins {
+						select {
+						case results <- OriginResult{Key: key, Details: buildDetails(originIndex)}:
+						case <-ctx.Done():
+							return
+						}
+					}
+				}
+			}()
+		}
+
+	dispatch:
+		for _, group := range groups {
+			select {
+			case groupCh <- group:
+			case <-ctx.Done():
+				break dispatch
+			}
+		}
+		close(groupCh)
+
+		wg.Wait()
+
+		if firstErr != nil {
+			errs <- firstErr
+		} else if err := ctx.Err(); err != nil {
+			errs <- err
+		}
+	}()
+
+	return results, errs
+}
+
+// resolveGroupOrigins walks chainLayers backwards from the newest layer and returns, for every
+// inventory key in group, the index of the layer in which it was introduced: the layer just newer
+// than the first layer (scanning backwards) where the key is no longer present, or the oldest
+// layer if it is present throughout. Group members stop being tracked (and are removed from subsequent extractor runs'
+// bookkeeping) as soon as their origin is resolved, so a group doesn't pay to keep re-checking
+// keys it has already placed.
+func resolveGroupOrigins(ctx context.Context, group *inventoryGroup, chainLayers []scalibrImage.ChainLayer, layerToDiffID map[int]string, config *filesystem.Config, layerChanges map[int]map[string]changeKind, presenceCache *layerPresenceCache, lastLayerIndex int) (map[extractor.InventoryKey]int, error) {
+	origins := make(map[extractor.InventoryKey]int, len(group.keys))
+
+	if len(group.locations) == 0 {
+		// Group missing locations, cannot trace origin: treat it as introduced at the newest layer,
+		// matching ResolveOriginLayer's behavior for location-less inventory.
+		for _, key := range group.keys {
+			origins[key] = lastLayerIndex
+		}
+		return origins, nil
+	}
+
+	pending := make(map[extractor.InventoryKey]bool, len(group.keys))
+	for _, key := range group.keys {
+		pending[key] = true
+	}
+
+	for i := len(chainLayers) - 2; i >= 0 && len(pending) > 0; i-- {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		// If none of this group's locations changed going from layer i to layer i+1, every pending
+		// key's presence at layer i must match what was already established at layer i+1: keep
+		// walking backwards without paying for another extractor run.
+		if layerChanges != nil && allLocationsUnchanged(group.locations, layerChanges[i+1]) {
+			continue
+		}
+
+		cacheKey := presenceCacheKey{layer: i, group: group.key}
+		foundKeys, ok := presenceCache.get(cacheKey)
+		if !ok {
+			oldChainLayer := chainLayers[i]
+			oldInventory, err := runCached(ctx, config.CacheManager, layerToDiffID[i], oldChainLayer.FS(), buildExtractorConfig(config, group.locations, oldChainLayer.FS()))
+			if err != nil {
+				return nil, err
+			}
+
+			foundKeys = make(map[extractor.InventoryKey]bool, len(oldInventory))
+			for _, oldInv := range oldInventory {
+				oldInvKey, err := oldInv.ToKey()
+				if err != nil {
+					continue
+				}
+				foundKeys[oldInvKey] = true
+			}
+			presenceCache.add(cacheKey, foundKeys)
+		}
+
+		for key := range pending {
+			if !foundKeys[key] {
+				origins[key] = i + 1
+				delete(pending, key)
+			}
+		}
+	}
+
+	// Anything still pending was present in every layer checked, so it was introduced in the
+	// first layer.
+	for key := range pending {
+		origins[key] = 0
+	}
+
+	return origins, nil
+}
+
+// inventoryGroup is a set of inventory items that share both their originating extractor and
+// their file locations.
+type inventoryGroup struct {
+	key       string
+	locations []string
+	keys      []extractor.InventoryKey
+}
+
+// groupInventory partitions inventory into groups sharing an extractor and a set of locations,
+// preserving the order groups were first seen in.
+func groupInventory(inventory []*extractor.Inventory) []*inventoryGroup {
+	groups := make(map[string]*inventoryGroup)
+	var order []string
+
+	for _, inv := range inventory {
+		key, err := inv.ToKey()
+		if err != nil {
+			continue
+		}
+
+		groupKey := inventoryGroupKey(inv)
+		group, ok := groups[groupKey]
+		if !ok {
+			group = &inventoryGroup{key: groupKey, locations: inv.Locations}
+			groups[groupKey] = group
+			order = append(order, groupKey)
+		}
+		group.keys = append(group.keys, key)
+	}
+
+	result := make([]*inventoryGroup, 0, len(order))
+	for _, groupKey := range order {
+		result = append(result, groups[groupKey])
+	}
+	return result
+}
+
+// inventoryGroupKey returns a string uniquely identifying inv's (extractor, locations) pair.
+func inventoryGroupKey(inv *extractor.Inventory) string {
+	locations := append([]string(nil), inv.Locations...)
+	sort.Strings(locations)
+	return inv.Extractor.Name() + "\x00" + strings.Join(locations, "\x00")
+}
+
+// presenceCacheKey identifies one group's extraction result at one chain layer.
+type presenceCacheKey struct {
+	layer int
+	group string
+}
+
+// layerPresenceCache is a bounded LRU cache, shared by every worker in the pool, of which
+// inventory keys were found present the last time a given group was extracted against a given
+// layer. It exists so that the concurrent pool doesn't need to keep every layer's extraction
+// result alive in memory for the lifetime of a large trace.
+type layerPresenceCache struct {
+	mu       sync.Mutex
+	capacity int
+	order    *list.List
+	entries  map[presenceCacheKey]*list.Element
+}
+
+type layerPresenceEntry struct {
+	key     presenceCacheKey
+	present map[extractor.InventoryKey]bool
+}
+
+func newLayerPresenceCache(capacity int) *layerPresenceCache {
+	return &layerPresenceCache{
+		capacity: capacity,
+		order:    list.New(),
+		entries:  make(map[presenceCacheKey]*list.Element),
+	}
+}
+
+// get returns the presence results cached for key, if any.
+func (c *layerPresenceCache) get(key presenceCacheKey) (map[extractor.InventoryKey]bool, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	el, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	c.order.MoveToFront(el)
+	return el.Value.(*layerPresenceEntry).present, true
+}
+
+// add records present for key, evicting the least recently used entry if the cache is over
+// capacity.
+func (c *layerPresenceCache) add(key presenceCacheKey, present map[extractor.InventoryKey]bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if el, ok := c.entries[key]; ok {
+		el.Value.(*layerPresenceEntry).present = present
+		c.order.MoveToFront(el)
+		return
+	}
+
+	el := c.order.PushFront(&layerPresenceEntry{key: key, present: present})
+	c.entries[key] = el
+
+	if c.order.Len() > c.capacity {
+		oldest := c.order.Back()
+		if oldest != nil {
+			c.order.Remove(oldest)
+			delete(c.entries, oldest.Value.(*layerPresenceEntry).key)
+		}
+	}
+}
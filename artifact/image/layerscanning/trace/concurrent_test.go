@@ -0,0 +1,114 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trace
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/osv-scalibr/artifact/image"
+	"github.com/google/osv-scalibr/extractor"
+	"github.com/google/osv-scalibr/extractor/filesystem"
+	"github.com/google/osv-scalibr/stats"
+	"github.com/google/osv-scalibr/testing/fakeextractor"
+)
+
+func TestGroupInventory(t *testing.T) {
+	fakeExtractor := fakeextractor.New("fake-extractor", 1, nil, nil)
+
+	foo := &extractor.Inventory{Name: "foo", Version: "1.0", Locations: []string{"manifest"}, Extractor: fakeExtractor}
+	bar := &extractor.Inventory{Name: "bar", Version: "1.0", Locations: []string{"manifest"}, Extractor: fakeExtractor}
+	baz := &extractor.Inventory{Name: "baz", Version: "1.0", Locations: []string{"other"}, Extractor: fakeExtractor}
+
+	groups := groupInventory([]*extractor.Inventory{foo, bar, baz})
+	if len(groups) != 2 {
+		t.Fatalf("groupInventory(...) returned %d groups, want 2: %+v", len(groups), groups)
+	}
+
+	var manifestGroup, otherGroup *inventoryGroup
+	for _, g := range groups {
+		switch g.locations[0] {
+		case "manifest":
+			manifestGroup = g
+		case "other":
+			otherGroup = g
+		}
+	}
+
+	if manifestGroup == nil || len(manifestGroup.keys) != 2 {
+		t.Errorf("groupInventory(...) manifest group = %+v, want 2 keys", manifestGroup)
+	}
+	if otherGroup == nil || len(otherGroup.keys) != 1 {
+		t.Errorf("groupInventory(...) other group = %+v, want 1 key", otherGroup)
+	}
+}
+
+// TestResolveOriginLayerConcurrentMatchesSequential checks that tracing a group of inventory
+// items sharing a single manifest file gives the same result whether TraceConcurrency is left at
+// its default (sequential) or raised, across several chain layers where the manifest file is
+// added, removed, and re-added.
+func TestResolveOriginLayerConcurrentMatchesSequential(t *testing.T) {
+	const (
+		manifestFile = "manifest"
+		fooPackage   = "foo"
+		barPackage   = "bar"
+	)
+
+	fakeExtractor := fakeextractor.New("fake-extractor", 1, []string{manifestFile}, map[string]fakeextractor.NamesErr{
+		manifestFile: fakeextractor.NamesErr{Names: []string{fooPackage, barPackage}},
+	})
+
+	// Layer 0: manifest present.
+	fakeChainLayer1 := setupFakeChainLayer(t, t.TempDir(), 0, "diff-id-1", "command-1", map[string]string{
+		manifestFile: "v1",
+	})
+	// Layer 1: manifest removed.
+	fakeChainLayer2 := setupFakeChainLayer(t, t.TempDir(), 1, "diff-id-2", "command-2", map[string]string{})
+	// Layer 2: manifest reintroduced.
+	fakeChainLayer3 := setupFakeChainLayer(t, t.TempDir(), 2, "diff-id-3", "command-3", map[string]string{
+		manifestFile: "v2",
+	})
+
+	inventory := []*extractor.Inventory{
+		{Name: fooPackage, Locations: []string{manifestFile}, Extractor: fakeExtractor},
+		{Name: barPackage, Locations: []string{manifestFile}, Extractor: fakeExtractor},
+	}
+	chainLayers := []image.ChainLayer{fakeChainLayer1, fakeChainLayer2, fakeChainLayer3}
+
+	fooKey, err := inventory[0].ToKey()
+	if err != nil {
+		t.Fatalf("inventory[0].ToKey() failed: %v", err)
+	}
+	barKey, err := inventory[1].ToKey()
+	if err != nil {
+		t.Fatalf("inventory[1].ToKey() failed: %v", err)
+	}
+
+	for _, concurrency := range []int{0, 1, 8} {
+		config := &filesystem.Config{
+			Stats:            stats.NoopCollector{},
+			Extractors:       []filesystem.Extractor{fakeExtractor},
+			TraceConcurrency: concurrency,
+		}
+
+		got := ResolveOriginLayer(context.Background(), inventory, chainLayers, config)
+
+		for _, key := range []extractor.InventoryKey{fooKey, barKey} {
+			if got[key] == nil || got[key].Index != 2 {
+				t.Errorf("TraceConcurrency=%d: ResolveOriginLayer(...)[%v].Index = %+v, want Index 2 (reintroduced after the manifest was removed)", concurrency, key, got[key])
+			}
+		}
+	}
+}
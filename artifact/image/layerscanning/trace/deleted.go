@@ -0,0 +1,134 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trace
+
+import (
+	"context"
+
+	scalibrImage "github.com/google/osv-scalibr/artifact/image"
+	"github.com/google/osv-scalibr/extractor"
+	"github.com/google/osv-scalibr/extractor/filesystem"
+	scalibrfs "github.com/google/osv-scalibr/fs"
+)
+
+// ResolveDeletedPackages walks chainLayers forward (oldest to newest), running extraction
+// against every chain layer, and returns one tombstone Inventory for every package that was
+// present in some layer and then removed or overlaid by a newer copy (via e.g. `apt-get purge`,
+// `rm -rf`, or a later COPY/layer squash) in a subsequent layer. This is only done when
+// config.TraceDeleted is set, since it requires a full extraction pass per chain layer rather
+// than the targeted, per-location reruns ResolveOriginLayer does.
+//
+// Callers typically append the returned tombstones to the live inventory list (e.g. the result
+// of PopulateLayerDetails) so downstream consumers can distinguish "package still present" from
+// "package installed then removed" -- the same distinction Trivy added for secret findings
+// across layers.
+func ResolveDeletedPackages(ctx context.Context, chainLayers []scalibrImage.ChainLayer, config *filesystem.Config) ([]*extractor.Inventory, error) {
+	if !config.TraceDeleted || len(chainLayers) < 2 {
+		return nil, nil
+	}
+
+	layerToDiffID := make(map[int]string)
+	layerToCommands := make(map[int]string)
+	for i, chainLayer := range chainLayers {
+		layerToDiffID[i] = chainLayer.Layer().DiffID()
+		layerToCommands[i] = chainLayer.Layer().Command()
+	}
+
+	makeExtractorConfig := func(chainFS scalibrfs.FS) *filesystem.Config {
+		return &filesystem.Config{
+			Stats:                 config.Stats,
+			ReadSymlinks:          config.ReadSymlinks,
+			Extractors:            config.Extractors,
+			DirsToSkip:            config.DirsToSkip,
+			SkipDirRegex:          config.SkipDirRegex,
+			SkipDirGlob:           config.SkipDirGlob,
+			MaxInodes:             config.MaxInodes,
+			StoreAbsolutePath:     config.StoreAbsolutePath,
+			PrintDurationAnalysis: config.PrintDurationAnalysis,
+			ScanRoots: []*scalibrfs.ScanRoot{
+				&scalibrfs.ScanRoot{
+					FS: chainFS,
+				},
+			},
+		}
+	}
+
+	var tombstones []*extractor.Inventory
+	var prevLayer map[extractor.InventoryKey]*extractor.Inventory
+	// firstSeen records, for every key observed so far, the earliest chain layer index it appeared
+	// in across the whole forward walk. A tombstone's origin is that layer, not just the layer
+	// immediately before the one it went missing in: a package present since layer 0 and removed at
+	// layer 3 was introduced at 0, not 2.
+	firstSeen := make(map[extractor.InventoryKey]int)
+
+	for i, chainLayer := range chainLayers {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		inv, _, err := filesystem.Run(ctx, makeExtractorConfig(chainLayer.FS()))
+		if err != nil {
+			return nil, err
+		}
+
+		current := make(map[extractor.InventoryKey]*extractor.Inventory, len(inv))
+		for _, item := range inv {
+			key, err := item.ToKey()
+			if err != nil {
+				continue
+			}
+			current[key] = item
+			if _, ok := firstSeen[key]; !ok {
+				firstSeen[key] = i
+			}
+		}
+
+		for key, prevItem := range prevLayer {
+			if _, stillPresent := current[key]; stillPresent {
+				continue
+			}
+
+			tombstones = append(tombstones, deletionTombstone(prevItem, firstSeen[key], i, layerToDiffID, layerToCommands))
+		}
+
+		prevLayer = current
+	}
+
+	return tombstones, nil
+}
+
+// deletionTombstone builds a tombstone Inventory for a package first seen at introducedAt and
+// confirmed missing at removedAt.
+func deletionTombstone(inv *extractor.Inventory, introducedAt, removedAt int, layerToDiffID, layerToCommands map[int]string) *extractor.Inventory {
+	return &extractor.Inventory{
+		Name:        inv.Name,
+		Version:     inv.Version,
+		SourceCode:  inv.SourceCode,
+		Locations:   inv.Locations,
+		Extractor:   inv.Extractor,
+		Annotations: inv.Annotations,
+		LayerDetails: &extractor.LayerDetails{
+			Index:   introducedAt,
+			DiffID:  layerToDiffID[introducedAt],
+			Command: layerToCommands[introducedAt],
+			Deleted: true,
+			DeletedInLayer: &extractor.LayerDetails{
+				Index:   removedAt,
+				DiffID:  layerToDiffID[removedAt],
+				Command: layerToCommands[removedAt],
+			},
+		},
+	}
+}
@@ -0,0 +1,142 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trace
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/osv-scalibr/artifact/image"
+	"github.com/google/osv-scalibr/extractor/filesystem"
+	"github.com/google/osv-scalibr/stats"
+	"github.com/google/osv-scalibr/testing/fakeextractor"
+)
+
+func TestResolveDeletedPackages(t *testing.T) {
+	const (
+		fooFile = "foo.txt"
+		barFile = "bar.txt"
+
+		fooPackage = "foo"
+		barPackage = "bar"
+	)
+
+	fakeChainLayer1 := setupFakeChainLayer(t, t.TempDir(), 0, "diff-id-1", "command-1", map[string]string{
+		fooFile: fooPackage,
+		barFile: barPackage,
+	})
+	fakeChainLayer2 := setupFakeChainLayer(t, t.TempDir(), 1, "diff-id-2", "command-2", map[string]string{
+		fooFile: fooPackage,
+	})
+
+	fakeExtractor := fakeextractor.New("fake-extractor", 1, []string{fooFile, barFile}, map[string]fakeextractor.NamesErr{
+		fooFile: fakeextractor.NamesErr{Names: []string{fooPackage}},
+		barFile: fakeextractor.NamesErr{Names: []string{barPackage}},
+	})
+
+	tests := []struct {
+		name         string
+		traceDeleted bool
+		chainLayers  []image.ChainLayer
+		wantDeleted  int
+		wantOrigin   int
+	}{
+		{
+			name:         "TraceDeleted disabled",
+			traceDeleted: false,
+			chainLayers:  []image.ChainLayer{fakeChainLayer1, fakeChainLayer2},
+			wantDeleted:  0,
+		},
+		{
+			name:         "bar package deleted in second layer",
+			traceDeleted: true,
+			chainLayers:  []image.ChainLayer{fakeChainLayer1, fakeChainLayer2},
+			wantDeleted:  1,
+			wantOrigin:   0,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			config := &filesystem.Config{
+				Stats:          stats.NoopCollector{},
+				FilesToExtract: []string{"Installed"},
+				Extractors:     []filesystem.Extractor{fakeExtractor},
+				TraceDeleted:   tc.traceDeleted,
+			}
+
+			got, err := ResolveDeletedPackages(context.Background(), tc.chainLayers, config)
+			if err != nil {
+				t.Fatalf("ResolveDeletedPackages(ctx, %v, config) returned an error: %v", tc.chainLayers, err)
+			}
+
+			if len(got) != tc.wantDeleted {
+				t.Errorf("ResolveDeletedPackages(ctx, %v, config) returned %d tombstones, want %d", tc.chainLayers, len(got), tc.wantDeleted)
+			}
+
+			for _, tombstone := range got {
+				if !tombstone.LayerDetails.Deleted {
+					t.Errorf("tombstone %v: LayerDetails.Deleted = false, want true", tombstone)
+				}
+				if tombstone.LayerDetails.DeletedInLayer == nil {
+					t.Errorf("tombstone %v: LayerDetails.DeletedInLayer = nil, want non-nil", tombstone)
+				}
+				if tc.wantDeleted > 0 && tombstone.LayerDetails.Index != tc.wantOrigin {
+					t.Errorf("tombstone %v: LayerDetails.Index = %d, want %d", tombstone, tombstone.LayerDetails.Index, tc.wantOrigin)
+				}
+			}
+		})
+	}
+}
+
+// TestResolveDeletedPackagesOriginIsFirstAppearance covers the case a single before/after pair
+// can't: a package present since the very first layer, carried unchanged through several more,
+// then removed. Its reported origin must be the layer it first appeared in, not the layer just
+// before the removal.
+func TestResolveDeletedPackagesOriginIsFirstAppearance(t *testing.T) {
+	const fooFile = "foo.txt"
+	const fooPackage = "foo"
+
+	layer1 := setupFakeChainLayer(t, t.TempDir(), 0, "diff-id-1", "command-1", map[string]string{fooFile: fooPackage})
+	layer2 := setupFakeChainLayer(t, t.TempDir(), 1, "diff-id-2", "command-2", map[string]string{fooFile: fooPackage})
+	layer3 := setupFakeChainLayer(t, t.TempDir(), 2, "diff-id-3", "command-3", map[string]string{})
+
+	fakeExtractor := fakeextractor.New("fake-extractor", 1, []string{fooFile}, map[string]fakeextractor.NamesErr{
+		fooFile: fakeextractor.NamesErr{Names: []string{fooPackage}},
+	})
+
+	config := &filesystem.Config{
+		Stats:          stats.NoopCollector{},
+		FilesToExtract: []string{"Installed"},
+		Extractors:     []filesystem.Extractor{fakeExtractor},
+		TraceDeleted:   true,
+	}
+
+	chainLayers := []image.ChainLayer{layer1, layer2, layer3}
+	got, err := ResolveDeletedPackages(context.Background(), chainLayers, config)
+	if err != nil {
+		t.Fatalf("ResolveDeletedPackages(ctx, %v, config) returned an error: %v", chainLayers, err)
+	}
+
+	if len(got) != 1 {
+		t.Fatalf("ResolveDeletedPackages(ctx, %v, config) returned %d tombstones, want 1", chainLayers, len(got))
+	}
+	if got[0].LayerDetails.Index != 0 {
+		t.Errorf("tombstone %v: LayerDetails.Index = %d, want 0 (first appeared in layer 0, not layer 1)", got[0], got[0].LayerDetails.Index)
+	}
+	if got[0].LayerDetails.DeletedInLayer.Index != 2 {
+		t.Errorf("tombstone %v: LayerDetails.DeletedInLayer.Index = %d, want 2", got[0], got[0].LayerDetails.DeletedInLayer.Index)
+	}
+}
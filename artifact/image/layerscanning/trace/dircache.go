@@ -0,0 +1,100 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trace
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+
+	scalibrfs "github.com/google/osv-scalibr/fs"
+)
+
+// dirEntryDigests computes the HeaderDigest and ContentDigest contentcache.FileEntry documents
+// for the directory at dirPath within fsys: HeaderDigest folds in each child's name with its
+// size and mtime (for a subdirectory, that subdirectory's own HeaderDigest, so it covers the
+// whole subtree's metadata without reading any file content), and changes when anything is
+// added, removed, or renamed anywhere under dirPath. ContentDigest recursively folds
+// in every descendant file's own content digest, so an entire unchanged subtree can be reused --
+// and its combined extraction result served straight from cache -- from a single lookup, instead
+// of re-stating (let alone re-extracting) every file under it individually.
+func dirEntryDigests(fsys scalibrfs.FS, dirPath string) (header, content [32]byte, err error) {
+	entries, err := fs.ReadDir(fsys, dirPath)
+	if err != nil {
+		return [32]byte{}, [32]byte{}, err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+
+	headerHash := sha256.New()
+	contentHash := sha256.New()
+
+	for _, entry := range entries {
+		childPath := path.Join(dirPath, entry.Name())
+
+		var childHeader, childContent [32]byte
+		if entry.IsDir() {
+			childHeader, childContent, err = dirEntryDigests(fsys, childPath)
+		} else {
+			if childHeader, err = fileHeaderDigest(fsys, childPath); err == nil {
+				childContent, err = fileContentDigest(fsys, childPath)
+			}
+		}
+		if err != nil {
+			return [32]byte{}, [32]byte{}, err
+		}
+
+		fmt.Fprintf(headerHash, "%s\x00%x\n", entry.Name(), childHeader)
+		fmt.Fprintf(contentHash, "%s\x00%x\n", entry.Name(), childContent)
+	}
+
+	var headerDigest, contentDigest [32]byte
+	copy(headerDigest[:], headerHash.Sum(nil))
+	copy(contentDigest[:], contentHash.Sum(nil))
+	return headerDigest, contentDigest, nil
+}
+
+// fileHeaderDigest returns a digest of a file's extraction-relevant metadata (size and mtime): a
+// cheap, content-free check that dirEntryDigests uses for every file in a directory listing.
+func fileHeaderDigest(fsys scalibrfs.FS, p string) ([32]byte, error) {
+	info, err := fs.Stat(fsys, p)
+	if err != nil {
+		return [32]byte{}, err
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%d\x00%d", info.Size(), info.ModTime().UnixNano())
+
+	var digest [32]byte
+	copy(digest[:], h.Sum(nil))
+	return digest, nil
+}
+
+// commonDir returns the directory every path in locations lives directly in, or ("", false) if
+// locations is empty or its members don't all share one.
+func commonDir(locations []string) (string, bool) {
+	if len(locations) == 0 {
+		return "", false
+	}
+
+	dir := path.Dir(path.Clean(locations[0]))
+	for _, loc := range locations[1:] {
+		if path.Dir(path.Clean(loc)) != dir {
+			return "", false
+		}
+	}
+	return dir, true
+}
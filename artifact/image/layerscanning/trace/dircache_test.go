@@ -0,0 +1,107 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trace
+
+import (
+	"context"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/google/osv-scalibr/artifact/image/contentcache"
+	"github.com/google/osv-scalibr/extractor"
+	"github.com/google/osv-scalibr/extractor/filesystem"
+	scalibrfs "github.com/google/osv-scalibr/fs"
+	"github.com/google/osv-scalibr/stats"
+)
+
+// countingExtractor is a filesystem.Extractor that records how many times Extract runs, so tests
+// can tell a cache hit (no call) apart from a cache miss (a call).
+type countingExtractor struct {
+	calls int
+}
+
+func (e *countingExtractor) Name() string                          { return "counting-extractor" }
+func (e *countingExtractor) Version() int                          { return 1 }
+func (e *countingExtractor) Ecosystem(*extractor.Inventory) string { return "PyPI" }
+func (e *countingExtractor) ToPURL(inv *extractor.Inventory) *extractor.PackageURL {
+	return &extractor.PackageURL{Type: "pypi", Name: inv.Name}
+}
+func (e *countingExtractor) FileRequired(path string, fileinfo fs.FileInfo) bool { return true }
+func (e *countingExtractor) Extract(ctx context.Context, input *filesystem.ScanInput) ([]*extractor.Inventory, error) {
+	e.calls++
+	return []*extractor.Inventory{{Name: "pkg-" + input.Path, Locations: []string{input.Path}, Extractor: e}}, nil
+}
+
+func writeDir(t *testing.T, dir string, files map[string]string) scalibrfs.FS {
+	t.Helper()
+	for name, content := range files {
+		full := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(full), 0o755); err != nil {
+			t.Fatalf("MkdirAll(%q) failed: %v", filepath.Dir(full), err)
+		}
+		if err := os.WriteFile(full, []byte(content), 0o644); err != nil {
+			t.Fatalf("WriteFile(%q) failed: %v", full, err)
+		}
+	}
+	return os.DirFS(dir).(scalibrfs.FS)
+}
+
+func TestRunCachedDirReusesUnchangedSubtree(t *testing.T) {
+	files := map[string]string{
+		"pkg/a.txt": "a",
+		"pkg/b.txt": "b",
+	}
+	fsys1 := writeDir(t, t.TempDir(), files)
+	fsys2 := writeDir(t, t.TempDir(), files)
+
+	ext := &countingExtractor{}
+	newConfig := func(fsys scalibrfs.FS) *filesystem.Config {
+		return &filesystem.Config{
+			Stats:          stats.NoopCollector{},
+			FilesToExtract: []string{"pkg/a.txt", "pkg/b.txt"},
+			Extractors:     []filesystem.Extractor{ext},
+			ScanRoots:      []*scalibrfs.ScanRoot{{FS: fsys}},
+		}
+	}
+
+	manager := contentcache.NewManager()
+
+	if _, err := runCached(context.Background(), manager, "diff-id-1", fsys1, newConfig(fsys1)); err != nil {
+		t.Fatalf("runCached() failed: %v", err)
+	}
+	if ext.calls != 2 {
+		t.Fatalf("after first (uncached) run, calls = %d, want 2 (one per file)", ext.calls)
+	}
+
+	// Same diffID, same (unchanged) directory: should be served entirely from the directory-level
+	// cache entry without calling Extract again.
+	if _, err := runCached(context.Background(), manager, "diff-id-1", fsys1, newConfig(fsys1)); err != nil {
+		t.Fatalf("runCached() failed: %v", err)
+	}
+	if ext.calls != 2 {
+		t.Errorf("after second run against the same unchanged layer, calls = %d, want 2 (served from cache)", ext.calls)
+	}
+
+	// A different diffID with identical directory content does not share the entry: Manager
+	// stores one CacheContext per diffID, so a distinct diffID starts cold.
+	if _, err := runCached(context.Background(), manager, "diff-id-2", fsys2, newConfig(fsys2)); err != nil {
+		t.Fatalf("runCached() failed: %v", err)
+	}
+	if ext.calls != 4 {
+		t.Errorf("after running against a new diffID's CacheContext, calls = %d, want 4 (cold cache for this diffID)", ext.calls)
+	}
+}
@@ -0,0 +1,143 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trace
+
+import (
+	"bufio"
+	"io"
+	"strings"
+
+	scalibrImage "github.com/google/osv-scalibr/artifact/image"
+	"github.com/google/osv-scalibr/extractor/filesystem"
+)
+
+// DockerfileInstruction is one parsed instruction from a Dockerfile, with line-continuations
+// already joined.
+type DockerfileInstruction struct {
+	// Line is the 1-indexed line the instruction starts on.
+	Line int
+	// Instruction is the uppercased instruction keyword, e.g. "RUN", "COPY", "ADD".
+	Instruction string
+	// Raw is the full instruction text, with continuations joined onto one line.
+	Raw string
+}
+
+// ParseDockerfile parses r into its instructions, skipping blank lines and comments and joining
+// backslash line-continuations.
+func ParseDockerfile(r io.Reader) ([]DockerfileInstruction, error) {
+	var instructions []DockerfileInstruction
+
+	var pending strings.Builder
+	pendingStart := 0
+	lineNo := 0
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		lineNo++
+		raw := scanner.Text()
+		check := strings.TrimSpace(raw)
+		if check == "" || strings.HasPrefix(check, "#") {
+			continue
+		}
+
+		if pending.Len() == 0 {
+			pendingStart = lineNo
+		}
+
+		// Only strip the trailing continuation backslash itself; keep the line's own leading
+		// whitespace intact so joined continuation lines read the same as a hand-joined instruction
+		// would (e.g. aligned RUN arguments), rather than collapsing to a single space.
+		if strings.HasSuffix(check, "\\") {
+			pending.WriteString(raw[:strings.LastIndex(raw, "\\")])
+			continue
+		}
+
+		pending.WriteString(raw)
+		full := strings.TrimSpace(pending.String())
+		pending.Reset()
+
+		fields := strings.Fields(full)
+		if len(fields) == 0 {
+			continue
+		}
+
+		instructions = append(instructions, DockerfileInstruction{
+			Line:        pendingStart,
+			Instruction: strings.ToUpper(fields[0]),
+			Raw:         full,
+		})
+	}
+
+	return instructions, scanner.Err()
+}
+
+// finalStageInstructions returns the instructions belonging to the final build stage of a
+// (possibly multi-stage) Dockerfile, i.e. everything after the last FROM (the FROM itself is not
+// included).
+func finalStageInstructions(instructions []DockerfileInstruction) []DockerfileInstruction {
+	lastFrom := -1
+	for i, instr := range instructions {
+		if instr.Instruction == "FROM" {
+			lastFrom = i
+		}
+	}
+	if lastFrom == -1 {
+		return instructions
+	}
+	return instructions[lastFrom+1:]
+}
+
+// DockerfileCorrelation is the Dockerfile source location attributed to one chain layer. It's an
+// alias of filesystem.DockerfileCorrelation (defined there instead of here to avoid a
+// filesystem<->trace import cycle, since filesystem.Config needs to reference it).
+type DockerfileCorrelation = filesystem.DockerfileCorrelation
+
+// isNonEmptyHistoryCommand reports whether command is non-blank. Layers with a blank history
+// command are not aligned with any instruction; non-blank commands are not further classified.
+func isNonEmptyHistoryCommand(command string) bool {
+	return strings.TrimSpace(command) != ""
+}
+
+// CorrelateDockerfile aligns each chain layer's history command, in order, with the Dockerfile
+// instructions of the final build stage (instructions before the last FROM belong to earlier,
+// discarded build stages and are never aligned). Alignment runs from the newest layer and the
+// last instruction backwards. Returns a map of chain layer index to the Dockerfile location that
+// produced it; layers with no corresponding instruction (e.g. more layers than instructions due
+// to base-image layers) are omitted.
+func CorrelateDockerfile(dockerfilePath string, chainLayers []scalibrImage.ChainLayer, instructions []DockerfileInstruction) map[int]*DockerfileCorrelation {
+	stage := finalStageInstructions(instructions)
+
+	correlation := make(map[int]*DockerfileCorrelation)
+
+	stageIdx := len(stage) - 1
+	for i := len(chainLayers) - 1; i >= 0; i-- {
+		if !isNonEmptyHistoryCommand(chainLayers[i].Layer().Command()) {
+			continue
+		}
+		if stageIdx < 0 {
+			break
+		}
+
+		instr := stage[stageIdx]
+		correlation[i] = &DockerfileCorrelation{
+			DockerfilePath: dockerfilePath,
+			DockerfileLine: instr.Line,
+			Instruction:    instr.Instruction,
+		}
+		stageIdx--
+	}
+
+	return correlation
+}
@@ -0,0 +1,100 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trace
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/google/osv-scalibr/artifact/image"
+)
+
+func TestParseDockerfile(t *testing.T) {
+	const dockerfile = `FROM golang:1.22 AS build
+# build the binary
+RUN go build \
+    -o /bin/app .
+
+FROM alpine:3.19
+COPY --from=build /bin/app /bin/app
+RUN apk add --no-cache ca-certificates
+`
+
+	got, err := ParseDockerfile(strings.NewReader(dockerfile))
+	if err != nil {
+		t.Fatalf("ParseDockerfile(...) returned an error: %v", err)
+	}
+
+	want := []DockerfileInstruction{
+		{Line: 1, Instruction: "FROM", Raw: "FROM golang:1.22 AS build"},
+		{Line: 3, Instruction: "RUN", Raw: "RUN go build     -o /bin/app ."},
+		{Line: 6, Instruction: "FROM", Raw: "FROM alpine:3.19"},
+		{Line: 7, Instruction: "COPY", Raw: "COPY --from=build /bin/app /bin/app"},
+		{Line: 8, Instruction: "RUN", Raw: "RUN apk add --no-cache ca-certificates"},
+	}
+
+	if len(got) != len(want) {
+		t.Fatalf("ParseDockerfile(...) returned %d instructions, want %d: %v", len(got), len(want), got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("ParseDockerfile(...)[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+}
+
+func TestCorrelateDockerfile(t *testing.T) {
+	const dockerfile = `FROM golang:1.22 AS build
+RUN go build -o /bin/app .
+
+FROM alpine:3.19
+COPY --from=build /bin/app /bin/app
+RUN apk add --no-cache ca-certificates
+`
+
+	instructions, err := ParseDockerfile(strings.NewReader(dockerfile))
+	if err != nil {
+		t.Fatalf("ParseDockerfile(...) returned an error: %v", err)
+	}
+
+	fakeChainLayer1 := setupFakeChainLayer(t, t.TempDir(), 0, "diff-id-1", "", map[string]string{"foo.txt": "foo"})
+	fakeChainLayer2 := setupFakeChainLayer(t, t.TempDir(), 1, "diff-id-2", "COPY --from=build /bin/app /bin/app", map[string]string{"foo.txt": "foo"})
+	fakeChainLayer3 := setupFakeChainLayer(t, t.TempDir(), 2, "diff-id-3", "RUN apk add --no-cache ca-certificates", map[string]string{"bar.txt": "bar"})
+
+	chainLayers := []image.ChainLayer{fakeChainLayer1, fakeChainLayer2, fakeChainLayer3}
+
+	got := CorrelateDockerfile("Dockerfile", chainLayers, instructions)
+
+	// Layer 0 has an empty history command (the base image layer) and should be skipped.
+	if _, ok := got[0]; ok {
+		t.Errorf("CorrelateDockerfile(...)[0] = %+v, want absent", got[0])
+	}
+
+	want := map[int]*DockerfileCorrelation{
+		1: {DockerfilePath: "Dockerfile", DockerfileLine: 5, Instruction: "COPY"},
+		2: {DockerfilePath: "Dockerfile", DockerfileLine: 6, Instruction: "RUN"},
+	}
+
+	for idx, wantCorrelation := range want {
+		gotCorrelation, ok := got[idx]
+		if !ok {
+			t.Errorf("CorrelateDockerfile(...)[%d] missing, want %+v", idx, wantCorrelation)
+			continue
+		}
+		if *gotCorrelation != *wantCorrelation {
+			t.Errorf("CorrelateDockerfile(...)[%d] = %+v, want %+v", idx, gotCorrelation, wantCorrelation)
+		}
+	}
+}
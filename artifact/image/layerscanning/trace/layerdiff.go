@@ -0,0 +1,201 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trace
+
+import (
+	"context"
+	"io/fs"
+	"path"
+	"strings"
+	"time"
+
+	scalibrImage "github.com/google/osv-scalibr/artifact/image"
+	scalibrfs "github.com/google/osv-scalibr/fs"
+)
+
+// changeKind describes how a path differs between one chain layer and the next.
+type changeKind int
+
+const (
+	// added means the path did not exist in the older layer.
+	added changeKind = iota
+	// modified means the path exists in both layers but its content differs.
+	modified
+	// deleted means the path existed in the older layer but was removed (directly, or via an
+	// OCI whiteout) by the newer one.
+	deleted
+)
+
+// computeLayerChanges precomputes, for each chain layer index i >= 1, the set of paths that
+// differ between chain layer i-1 and chain layer i. This lets ResolveOriginLayer skip
+// re-running extractors against layers where none of an inventory item's locations changed,
+// which is the common case on images with many unrelated layers.
+//
+// Where chain layer i's own Layer reports its tar diff (Layer.FileDiff ok=true), the change set
+// is built directly from that: O(layer's own entries) instead of O(total files in the image).
+// Layers that don't model that (ok=false, e.g. synthesized or squashed-only layers) fall back to
+// comparing the two layers' full squashed filesystems by path/size/mtime.
+func computeLayerChanges(ctx context.Context, chainLayers []scalibrImage.ChainLayer) (map[int]map[string]changeKind, error) {
+	changes := make(map[int]map[string]changeKind, len(chainLayers))
+
+	for i := 1; i < len(chainLayers); i++ {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		var diff map[string]changeKind
+		if ownFiles, ok := chainLayers[i].Layer().FileDiff(); ok {
+			diff = diffFromOwnFiles(ownFiles)
+		} else {
+			var err error
+			diff, err = diffChainLayerFiles(chainLayers[i-1].FS(), chainLayers[i].FS())
+			if err != nil {
+				return nil, err
+			}
+		}
+		changes[i] = diff
+	}
+
+	return changes, nil
+}
+
+// diffFromOwnFiles builds a change set directly from a layer's own tar/diff entries, as reported
+// by image.Layer.FileDiff: paths are added or modified verbatim, and a removed path is recorded
+// under its basename's ".wh." (OCI whiteout) prefix, mirroring how a layer tar itself marks
+// deletions.
+func diffFromOwnFiles(ownFiles []string) map[string]changeKind {
+	diff := make(map[string]changeKind, len(ownFiles))
+
+	for _, p := range ownFiles {
+		dir, base := path.Split(canonicalPath(p))
+		if name := strings.TrimPrefix(base, ".wh."); name != base {
+			diff[path.Join(dir, name)] = deleted
+			continue
+		}
+		diff[path.Join(dir, base)] = modified
+	}
+
+	return diff
+}
+
+// diffChainLayerFiles walks both (already whiteout-resolved) chain layer filesystems and
+// returns the set of paths that were added, modified, or deleted going from older to newer.
+// Paths are compared by size and modification time rather than content hashing, mirroring the
+// cheap metadata check OCI layer application tooling (e.g. containers/storage) uses before
+// falling back to a full content diff.
+func diffChainLayerFiles(older, newer scalibrfs.FS) (map[string]changeKind, error) {
+	oldFiles, err := statAllFiles(older)
+	if err != nil {
+		return nil, err
+	}
+
+	newFiles, err := statAllFiles(newer)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := make(map[string]changeKind)
+
+	for p, oldInfo := range oldFiles {
+		newInfo, ok := newFiles[p]
+		if !ok {
+			diff[p] = deleted
+			continue
+		}
+		if oldInfo.size != newInfo.size || !oldInfo.modTime.Equal(newInfo.modTime) {
+			diff[p] = modified
+		}
+	}
+
+	for p := range newFiles {
+		if _, ok := oldFiles[p]; !ok {
+			diff[p] = added
+		}
+	}
+
+	return diff, nil
+}
+
+type fileStat struct {
+	size    int64
+	modTime time.Time
+}
+
+// statAllFiles walks fsys and returns a map of cleaned path to its size/mtime.
+func statAllFiles(fsys scalibrfs.FS) (map[string]fileStat, error) {
+	files := make(map[string]fileStat)
+
+	err := fs.WalkDir(fsys, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() {
+			return nil
+		}
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		files[canonicalPath(p)] = fileStat{size: info.Size(), modTime: info.ModTime()}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return files, nil
+}
+
+// canonicalPath normalizes p into the single form every changes map key uses: always absolute
+// (leading "/"), with "." components and duplicate slashes cleaned up.
+func canonicalPath(p string) string {
+	return path.Clean("/" + strings.TrimPrefix(p, "/"))
+}
+
+// allLocationsUnchanged reports whether none of locations, or any of their ancestor directories,
+// appear in changes. Packages spanning multiple files (e.g. installed-file lists) require every
+// location to be unchanged before the layer can be skipped.
+//
+// An OCI whiteout for a directory (e.g. ".wh.somedir" from "rm -rf somedir") is recorded as a
+// single deletion of that directory, not of every file that used to live under it -- per
+// image.Layer.FileDiff's doc comment. So a location nested under a removed directory would never
+// itself appear in changes; ancestor directories must be checked too, or such a deletion is
+// wrongly treated as "unchanged".
+func allLocationsUnchanged(locations []string, changes map[string]changeKind) bool {
+	for _, loc := range locations {
+		p := canonicalPath(loc)
+		if _, ok := changes[p]; ok {
+			return false
+		}
+		for _, dir := range ancestorDirs(p) {
+			if _, ok := changes[dir]; ok {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// ancestorDirs returns every ancestor directory of canonical path p, from its immediate parent up
+// to (but not including) the root.
+func ancestorDirs(p string) []string {
+	var dirs []string
+	for dir := path.Dir(p); dir != "/"; dir = path.Dir(dir) {
+		dirs = append(dirs, dir)
+	}
+	return dirs
+}
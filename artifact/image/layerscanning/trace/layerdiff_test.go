@@ -0,0 +1,127 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package trace
+
+import (
+	"context"
+	"testing"
+
+	"github.com/google/osv-scalibr/artifact/image"
+	"github.com/google/osv-scalibr/artifact/image/layerscanning/testing/fakechainlayer"
+	"github.com/google/osv-scalibr/artifact/image/layerscanning/testing/fakelayer"
+)
+
+func TestComputeLayerChangesOwnFileDiff(t *testing.T) {
+	// Layer 1's own diff reports foo.txt added and bar.txt deleted via an OCI whiteout marker,
+	// without needing to compare full squashed filesystems.
+	layer1 := fakelayer.New("diff-id-1", "command-1", "foo.txt", ".wh.bar.txt")
+	chainLayer0, err := fakechainlayer.New(t.TempDir(), 0, "diff-id-0", "command-0", fakelayer.New("diff-id-0", "command-0"), map[string]string{
+		"bar.txt": "bar",
+	})
+	if err != nil {
+		t.Fatalf("fakechainlayer.New() failed: %v", err)
+	}
+	chainLayer1, err := fakechainlayer.New(t.TempDir(), 1, "diff-id-1", "command-1", layer1, map[string]string{
+		"foo.txt": "foo",
+	})
+	if err != nil {
+		t.Fatalf("fakechainlayer.New() failed: %v", err)
+	}
+
+	changes, err := computeLayerChanges(context.Background(), []image.ChainLayer{chainLayer0, chainLayer1})
+	if err != nil {
+		t.Fatalf("computeLayerChanges() failed: %v", err)
+	}
+
+	if allLocationsUnchanged([]string{"foo.txt"}, changes[1]) {
+		t.Errorf("allLocationsUnchanged([foo.txt], changes[1]) = true, want false: foo.txt was added in layer 1")
+	}
+	if allLocationsUnchanged([]string{"bar.txt"}, changes[1]) {
+		t.Errorf("allLocationsUnchanged([bar.txt], changes[1]) = true, want false: bar.txt was deleted in layer 1")
+	}
+	if !allLocationsUnchanged([]string{"baz.txt"}, changes[1]) {
+		t.Errorf("allLocationsUnchanged([baz.txt], changes[1]) = false, want true: baz.txt never appears in either layer")
+	}
+}
+
+func TestComputeLayerChangesFallsBackToFSDiff(t *testing.T) {
+	// Neither layer reports its own tar diff (FileDiff ok=false), so computeLayerChanges must fall
+	// back to comparing the two layers' full squashed filesystems.
+	chainLayer0, err := fakechainlayer.New(t.TempDir(), 0, "diff-id-0", "command-0", fakelayer.New("diff-id-0", "command-0"), map[string]string{
+		"foo.txt": "foo",
+		"bar.txt": "bar",
+	})
+	if err != nil {
+		t.Fatalf("fakechainlayer.New() failed: %v", err)
+	}
+	chainLayer1, err := fakechainlayer.New(t.TempDir(), 1, "diff-id-1", "command-1", fakelayer.New("diff-id-1", "command-1"), map[string]string{
+		"foo.txt": "foo",
+		"baz.txt": "baz",
+	})
+	if err != nil {
+		t.Fatalf("fakechainlayer.New() failed: %v", err)
+	}
+
+	changes, err := computeLayerChanges(context.Background(), []image.ChainLayer{chainLayer0, chainLayer1})
+	if err != nil {
+		t.Fatalf("computeLayerChanges() failed: %v", err)
+	}
+
+	if allLocationsUnchanged([]string{"bar.txt"}, changes[1]) {
+		t.Errorf("allLocationsUnchanged([bar.txt], changes[1]) = true, want false: bar.txt was removed in layer 1")
+	}
+	if allLocationsUnchanged([]string{"baz.txt"}, changes[1]) {
+		t.Errorf("allLocationsUnchanged([baz.txt], changes[1]) = true, want false: baz.txt was added in layer 1")
+	}
+	// foo.txt's content is unchanged, but its on-disk mtime isn't guaranteed to be identical across
+	// the two fixture directories, so it isn't asserted as unchanged here: diffChainLayerFiles may
+	// conservatively flag it as modified, which only costs an extra (still-correct) extractor run.
+}
+
+func TestComputeLayerChangesDirectoryWhiteoutCoversNestedFiles(t *testing.T) {
+	// Layer 1 removes "subdir" entirely via a single directory-level OCI whiteout, the way "rm -rf
+	// subdir" is recorded in a real layer tar -- not as one whiteout per file that used to live
+	// under it.
+	layer1 := fakelayer.New("diff-id-1", "command-1", ".wh.subdir")
+	chainLayer0, err := fakechainlayer.New(t.TempDir(), 0, "diff-id-0", "command-0", fakelayer.New("diff-id-0", "command-0"), map[string]string{
+		"subdir/pkgfile": "pkgfile",
+	})
+	if err != nil {
+		t.Fatalf("fakechainlayer.New() failed: %v", err)
+	}
+	chainLayer1, err := fakechainlayer.New(t.TempDir(), 1, "diff-id-1", "command-1", layer1, map[string]string{})
+	if err != nil {
+		t.Fatalf("fakechainlayer.New() failed: %v", err)
+	}
+
+	changes, err := computeLayerChanges(context.Background(), []image.ChainLayer{chainLayer0, chainLayer1})
+	if err != nil {
+		t.Fatalf("computeLayerChanges() failed: %v", err)
+	}
+
+	if allLocationsUnchanged([]string{"subdir/pkgfile"}, changes[1]) {
+		t.Errorf("allLocationsUnchanged([subdir/pkgfile], changes[1]) = true, want false: subdir was deleted via a directory-level whiteout")
+	}
+}
+
+func TestAllLocationsUnchangedMatchesLeadingSlashVariants(t *testing.T) {
+	changes := map[string]changeKind{"/baz.txt": modified}
+
+	for _, loc := range []string{"baz.txt", "/baz.txt", "./baz.txt"} {
+		if allLocationsUnchanged([]string{loc}, changes) {
+			t.Errorf("allLocationsUnchanged([%q], changes) = true, want false: changes contains an equivalent path", loc)
+		}
+	}
+}
@@ -17,8 +17,11 @@ package trace
 
 import (
 	"context"
+	"crypto/sha256"
+	"io"
 
 	scalibrImage "github.com/google/osv-scalibr/artifact/image"
+	"github.com/google/osv-scalibr/artifact/image/contentcache"
 	"github.com/google/osv-scalibr/extractor"
 	"github.com/google/osv-scalibr/extractor/filesystem"
 	scalibrfs "github.com/google/osv-scalibr/fs"
@@ -51,106 +54,227 @@ func PopulateLayerDetails(inventory []*extractor.Inventory, originDetails map[ex
 // It does this by walking the chain layers from newest (last) to oldest (first) and checking if the
 // inventory is present in the newer layer. The first layer where the inventory is not present is
 // considered to be the layer in which the inventory was introduced.
+//
+// Internally this drains ResolveOriginLayerStream, which does the actual (possibly concurrent)
+// tracing; callers that want to start annotating inventory before the full trace completes
+// should call ResolveOriginLayerStream directly instead.
 func ResolveOriginLayer(ctx context.Context, inventory []*extractor.Inventory, chainLayers []scalibrImage.ChainLayer, config *filesystem.Config) map[extractor.InventoryKey]*extractor.LayerDetails {
-	layerToCommands := make(map[int]string)
-	layerToDiffID := make(map[int]string)
+	originDetails := make(map[extractor.InventoryKey]*extractor.LayerDetails, len(inventory))
+
+	results, errs := ResolveOriginLayerStream(ctx, inventory, chainLayers, config)
+	for result := range results {
+		originDetails[result.Key] = result.Details
+	}
+	// Draining errs is purely diagnostic here: a stream error means some groups were left
+	// unresolved, but whatever was resolved before the error is still valid and already merged
+	// into originDetails above, matching the old sequential behavior of stopping a given
+	// inventory item's walk on its first extraction error.
+	<-errs
+
+	return originDetails
+}
+
+// buildExtractorConfig derives a per-layer, per-location filesystem.Config from the scan-wide
+// config, the set of files to extract, and the chain layer filesystem to extract them from.
+func buildExtractorConfig(config *filesystem.Config, filesToExtract []string, chainFS scalibrfs.FS) *filesystem.Config {
+	return &filesystem.Config{
+		Stats:                 config.Stats,
+		ReadSymlinks:          config.ReadSymlinks,
+		Extractors:            config.Extractors,
+		DirsToSkip:            config.DirsToSkip,
+		SkipDirRegex:          config.SkipDirRegex,
+		SkipDirGlob:           config.SkipDirGlob,
+		MaxInodes:             config.MaxInodes,
+		StoreAbsolutePath:     config.StoreAbsolutePath,
+		PrintDurationAnalysis: config.PrintDurationAnalysis,
+		// All field values before this are from the Scan Config.
+		FilesToExtract: filesToExtract,
+		ScanRoots: []*scalibrfs.ScanRoot{
+			&scalibrfs.ScanRoot{
+				FS: chainFS,
+			},
+		},
+	}
+}
+
+// layerDetailsBuilder returns a function that builds the LayerDetails for a given chain layer
+// index, folding in the base image and Dockerfile correlation info from config. Computing the
+// base image match once upfront and reusing the returned closure avoids repeating that work (and
+// the per-layer command/DiffID lookups) for every inventory item or group being traced.
+func layerDetailsBuilder(chainLayers []scalibrImage.ChainLayer, config *filesystem.Config) func(index int) *extractor.LayerDetails {
+	layerToCommands := make(map[int]string, len(chainLayers))
+	layerToDiffID := make(map[int]string, len(chainLayers))
 	for i, chainLayer := range chainLayers {
 		layerToCommands[i] = chainLayer.Layer().Command()
 		layerToDiffID[i] = chainLayer.Layer().DiffID()
 	}
 
-	makeExtractorConfig := func(filesToExtract []string, chainFS scalibrfs.FS) *filesystem.Config {
-		return &filesystem.Config{
-			Stats:                 config.Stats,
-			ReadSymlinks:          config.ReadSymlinks,
-			Extractors:            config.Extractors,
-			DirsToSkip:            config.DirsToSkip,
-			SkipDirRegex:          config.SkipDirRegex,
-			SkipDirGlob:           config.SkipDirGlob,
-			MaxInodes:             config.MaxInodes,
-			StoreAbsolutePath:     config.StoreAbsolutePath,
-			PrintDurationAnalysis: config.PrintDurationAnalysis,
-			// All field values before this are from the Scan Config.
-			FilesToExtract: filesToExtract,
-			ScanRoots: []*scalibrfs.ScanRoot{
-				&scalibrfs.ScanRoot{
-					FS: chainFS,
-				},
-			},
+	var baseImagePrefixLen int
+	var baseImageRef string
+	if config.BaseImageMatcher != nil {
+		baseImagePrefixLen, baseImageRef = config.BaseImageMatcher.Match(chainLayers)
+	}
+
+	return func(index int) *extractor.LayerDetails {
+		details := &extractor.LayerDetails{
+			Index:        index,
+			DiffID:       layerToDiffID[index],
+			Command:      layerToCommands[index],
+			InBaseImage:  index < baseImagePrefixLen,
+			BaseImageRef: baseImageRefIfInBase(index, baseImagePrefixLen, baseImageRef),
 		}
+
+		if correlation, ok := config.DockerfileCorrelation[index]; ok {
+			details.DockerfilePath = correlation.DockerfilePath
+			details.DockerfileLine = correlation.DockerfileLine
+			details.Instruction = correlation.Instruction
+		}
+
+		return details
 	}
+}
 
-	originDetails := make(map[extractor.InventoryKey]*extractor.LayerDetails)
+// baseImageRefIfInBase returns ref if layerIndex falls within the matched base image prefix,
+// and "" otherwise.
+func baseImageRefIfInBase(layerIndex, prefixLen int, ref string) string {
+	if layerIndex < prefixLen {
+		return ref
+	}
+	return ""
+}
 
-	for _, inv := range inventory {
-		lastChainLayer := chainLayers[len(chainLayers)-1]
-		layerIndex := lastChainLayer.Index()
+// runCached runs extractorConfig's extractors against chainFS, reusing a prior result from
+// cacheManager when the content being extracted is unchanged from the entry cached for diffID.
+// cacheManager may be nil, in which case this always re-extracts.
+//
+// A single targeted file is cached directly under its own path, and reused only while its content
+// digest matches. A group of several
+// locations is cached as a unit, keyed by the directory they all live directly in (the common
+// case for a package's installed-file list), so that an entire unchanged subtree can be served
+// from one cache lookup instead of paying for individual per-file attribution that a combined
+// extraction run can't actually separate out. Groups whose locations don't share one directory
+// always re-extract, same as before directory-level caching existed.
+func runCached(ctx context.Context, cacheManager *contentcache.Manager, diffID string, chainFS scalibrfs.FS, extractorConfig *filesystem.Config) ([]*extractor.Inventory, error) {
+	if cacheManager == nil || len(extractorConfig.FilesToExtract) == 0 {
+		inv, _, err := filesystem.Run(ctx, extractorConfig)
+		return inv, err
+	}
 
-		invKey, err := inv.ToKey()
-		if err != nil {
-			continue
-		}
+	cacheCtx := cacheManager.GetCacheContext(diffID)
+
+	if len(extractorConfig.FilesToExtract) == 1 {
+		return runCachedSingleFile(ctx, cacheManager, cacheCtx, diffID, chainFS, extractorConfig)
+	}
+
+	dir, ok := commonDir(extractorConfig.FilesToExtract)
+	if !ok {
+		inv, _, err := filesystem.Run(ctx, extractorConfig)
+		return inv, err
+	}
+	return runCachedDir(ctx, cacheManager, cacheCtx, diffID, chainFS, dir, extractorConfig)
+}
+
+// runCachedSingleFile is runCached's path for a single targeted location.
+func runCachedSingleFile(ctx context.Context, cacheManager *contentcache.Manager, cacheCtx *contentcache.CacheContext, diffID string, chainFS scalibrfs.FS, extractorConfig *filesystem.Config) ([]*extractor.Inventory, error) {
+	path := extractorConfig.FilesToExtract[0]
+	digest, err := fileContentDigest(chainFS, path)
+	if err != nil {
+		// The file may simply not exist in this layer. Fall through to a normal run so the
+		// "not present" signal origin tracing relies on is preserved.
+		inv, _, runErr := filesystem.Run(ctx, extractorConfig)
+		return inv, runErr
+	}
 
-		originDetails[invKey] = &extractor.LayerDetails{
-			Index:       layerIndex,
-			DiffID:      layerToDiffID[layerIndex],
-			Command:     layerToCommands[layerIndex],
-			InBaseImage: false,
+	if entry, ok := cacheCtx.Lookup(path); ok && entry.ContentDigest == digest {
+		if inv, ok := inventoryForExtractors(entry, extractorConfig.Extractors); ok {
+			return inv, nil
 		}
+	}
+
+	inv, _, err := filesystem.Run(ctx, extractorConfig)
+	if err != nil {
+		return nil, err
+	}
 
-		var foundOrigin bool
-
-		// Go backwards through the chain layers and find the first layer where the inventory is not
-		// present. Such layer is the layer in which the inventory was introduced. If the inventory is
-		// present in all layers, then it means it was introduced in the first layer.
-		// TODO: b/381249869 - Optimization: Skip layers if file not found.
-		for i := len(chainLayers) - 2; i >= 0; i-- {
-			oldChainLayer := chainLayers[i]
-
-			if len(inv.Locations) == 0 {
-				// Inventory missing location, cannot trace origin.
-				break
-			}
-
-			oldInventory, _, err := filesystem.Run(ctx, makeExtractorConfig(inv.Locations, oldChainLayer.FS()))
-			if err != nil {
-				break
-			}
-
-			foundPackage := false
-			for _, oldInv := range oldInventory {
-				oldInvKey, err := oldInv.ToKey()
-				if err != nil {
-					continue
-				}
-
-				if oldInvKey == invKey {
-					foundPackage = true
-					break
-				}
-			}
-
-			// If the inventory is not present in the old layer, then it was introduced in layer i+1.
-			if !foundPackage {
-				originDetails[invKey] = &extractor.LayerDetails{
-					Index:   i + 1,
-					DiffID:  layerToDiffID[i+1],
-					Command: layerToCommands[i+1],
-				}
-				foundOrigin = true
-				break
-			}
+	cacheManager.SetCacheContext(diffID, cacheCtx.Insert(path, &contentcache.FileEntry{
+		ContentDigest: digest,
+		Inventory:     inventoryByExtractorName(inv),
+	}))
+
+	return inv, nil
+}
+
+// runCachedDir is runCached's path for a group of locations that all live directly in dir: the
+// directory's combined HeaderDigest/ContentDigest (see dirEntryDigests) stands in for every file
+// in it, so the whole group's extraction result is cached and reused as one subtree.
+func runCachedDir(ctx context.Context, cacheManager *contentcache.Manager, cacheCtx *contentcache.CacheContext, diffID string, chainFS scalibrfs.FS, dir string, extractorConfig *filesystem.Config) ([]*extractor.Inventory, error) {
+	header, content, err := dirEntryDigests(chainFS, dir)
+	if err != nil {
+		// The directory may simply not exist in this layer; fall through to a normal run so the
+		// "not present" signal origin tracing relies on is preserved.
+		inv, _, runErr := filesystem.Run(ctx, extractorConfig)
+		return inv, runErr
+	}
+
+	if entry, ok := cacheCtx.Lookup(dir); ok && entry.HeaderDigest == header && entry.ContentDigest == content {
+		if inv, ok := inventoryForExtractors(entry, extractorConfig.Extractors); ok {
+			return inv, nil
 		}
+	}
+
+	inv, _, err := filesystem.Run(ctx, extractorConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	cacheManager.SetCacheContext(diffID, cacheCtx.Insert(dir, &contentcache.FileEntry{
+		HeaderDigest:  header,
+		ContentDigest: content,
+		Inventory:     inventoryByExtractorName(inv),
+	}))
+
+	return inv, nil
+}
+
+// fileContentDigest returns the SHA-256 of the file at path within fsys.
+func fileContentDigest(fsys scalibrfs.FS, path string) ([32]byte, error) {
+	f, err := fsys.Open(path)
+	if err != nil {
+		return [32]byte{}, err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return [32]byte{}, err
+	}
+
+	var digest [32]byte
+	copy(digest[:], h.Sum(nil))
+	return digest, nil
+}
 
-		// If the inventory is not present in any layer, then it means it was introduced in the first
-		// layer.
-		if !foundOrigin {
-			originDetails[invKey] = &extractor.LayerDetails{
-				Index:   0,
-				DiffID:  layerToDiffID[0],
-				Command: layerToCommands[0],
-			}
+// inventoryForExtractors reconstructs the cached inventory for every extractor in extractors,
+// returning ok=false if entry has no cached result for at least one of them (forcing a re-run
+// rather than returning a partial/stale result).
+func inventoryForExtractors(entry *contentcache.FileEntry, extractors []filesystem.Extractor) ([]*extractor.Inventory, bool) {
+	var inv []*extractor.Inventory
+	for _, ext := range extractors {
+		cached, ok := entry.Inventory[ext.Name()]
+		if !ok {
+			return nil, false
 		}
+		inv = append(inv, cached...)
 	}
-	return originDetails
+	return inv, true
+}
+
+// inventoryByExtractorName groups inv by the name of the extractor that produced each item.
+func inventoryByExtractorName(inv []*extractor.Inventory) map[string][]*extractor.Inventory {
+	byExtractor := make(map[string][]*extractor.Inventory)
+	for _, i := range inv {
+		name := i.Extractor.Name()
+		byExtractor[name] = append(byExtractor[name], i)
+	}
+	return byExtractor
 }
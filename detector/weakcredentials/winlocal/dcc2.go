@@ -0,0 +1,168 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build windows
+
+package winlocal
+
+import (
+	"bufio"
+	"context"
+	"crypto/sha1" //nolint:gosec // required by the MSCacheV2/DCC2 spec, not used for security.
+	"os"
+	"strings"
+
+	"github.com/google/osv-scalibr/detector/weakcredentials/winlocal/securityreg"
+	"golang.org/x/crypto/pbkdf2"
+)
+
+// dcc2Iterations is the fixed PBKDF2 iteration count MSCacheV2 (DCC2) uses.
+const dcc2Iterations = 10240
+
+// dcc2KeyLen is the length, in bytes, of a DCC2 verifier.
+const dcc2KeyLen = 16
+
+// computeDCC2 derives the MSCacheV2 (DCC2) verifier for a candidate password's NT hash and a
+// (case-insensitive) username, following the scheme Windows uses to cache domain logons:
+// PBKDF2-HMAC-SHA1 over the NT hash, salted with the lowercased username, 10240 iterations.
+func computeDCC2(ntHash [16]byte, username string) [16]byte {
+	derived := pbkdf2.Key(ntHash[:], []byte(strings.ToLower(username)), dcc2Iterations, dcc2KeyLen, sha1.New)
+	var out [16]byte
+	copy(out[:], derived)
+	return out
+}
+
+// dcc2Candidates collects the distinct plaintext candidates: the embedded dictionaries'
+// plaintexts as they are, plus the rule-expanded candidates of every user-supplied wordlist. Unlike the local-account hash table, DCC2
+// verifiers are salted per-user, so candidates cannot be pre-hashed into a single lookup table;
+// instead they are computed against each cached user in turn.
+func (d Detector) dcc2Candidates() ([]string, error) {
+	seen := make(map[string]struct{})
+	var candidates []string
+
+	add := func(candidate string) {
+		if _, ok := seen[candidate]; !ok {
+			seen[candidate] = struct{}{}
+			candidates = append(candidates, candidate)
+		}
+	}
+
+	addEmbedded := func(file string) error {
+		scanner := bufio.NewScanner(strings.NewReader(file))
+		for scanner.Scan() {
+			parts := strings.Split(scanner.Text(), ";")
+			if len(parts) != 2 {
+				continue
+			}
+			add(parts[1])
+		}
+		return scanner.Err()
+	}
+
+	if err := addEmbedded(knownNTHashesFile); err != nil {
+		return nil, err
+	}
+	if err := addEmbedded(knownLMHashesFile); err != nil {
+		return nil, err
+	}
+
+	rules := d.rules
+	if rules == nil {
+		rules = DefaultRules()
+	}
+
+	addWordlist := func(lines []string) {
+		for _, line := range lines {
+			if line == "" {
+				continue
+			}
+			for _, mangled := range applyRules(line, rules) {
+				add(mangled)
+			}
+		}
+	}
+
+	for _, path := range d.dictionaryFiles {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, err
+		}
+
+		var lines []string
+		scanner := bufio.NewScanner(f)
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+		err = scanner.Err()
+		f.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		addWordlist(lines)
+	}
+
+	for _, r := range d.dictionaryReaders {
+		var lines []string
+		scanner := bufio.NewScanner(r)
+		for scanner.Scan() {
+			lines = append(lines, scanner.Text())
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+
+		addWordlist(lines)
+	}
+
+	return candidates, nil
+}
+
+// bruteforceDCC2 attempts to recover the cleartext password behind each cached domain user's
+// DCC2 verifier, using the same dictionaries and rules as the local-account bruteforce pass.
+func (d Detector) bruteforceDCC2(ctx context.Context, users []*securityreg.CachedDomainUser) (map[string]string, error) {
+	candidates, err := d.dcc2Candidates()
+	if err != nil {
+		return nil, err
+	}
+
+	results := make(map[string]string)
+	remaining := make([]*securityreg.CachedDomainUser, len(users))
+	copy(remaining, users)
+
+	for _, candidate := range candidates {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if len(remaining) == 0 {
+			break
+		}
+
+		// ntHash does not depend on the user being tested, so it is computed once per candidate
+		// here rather than once per (user, candidate) pair.
+		nt := ntHash(candidate)
+
+		unsolved := remaining[:0]
+		for _, user := range remaining {
+			if computeDCC2(nt, user.Username) == user.DCC2 {
+				results[user.Domain+`\`+user.Username] = candidate
+				continue
+			}
+			unsolved = append(unsolved, user)
+		}
+		remaining = unsolved
+	}
+
+	return results, nil
+}
@@ -0,0 +1,84 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build windows
+
+package winlocal
+
+import (
+	"context"
+	"encoding/hex"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/google/osv-scalibr/detector/weakcredentials/winlocal/securityreg"
+)
+
+func TestComputeDCC2(t *testing.T) {
+	got := computeDCC2(ntHash("password"), "Administrator")
+	want := "2abf7a31670107f14fe6f8ac1f40c47b"
+	if hex.EncodeToString(got[:]) != want {
+		t.Errorf("computeDCC2(ntHash(%q), %q) = %x, want %s", "password", "Administrator", got, want)
+	}
+}
+
+func TestComputeDCC2UsernameIsCaseInsensitive(t *testing.T) {
+	lower := computeDCC2(ntHash("password"), "administrator")
+	upper := computeDCC2(ntHash("password"), "ADMINISTRATOR")
+	mixed := computeDCC2(ntHash("password"), "Administrator")
+
+	if lower != upper || lower != mixed {
+		t.Errorf("computeDCC2 is not case-insensitive on username: lower=%x upper=%x mixed=%x", lower, upper, mixed)
+	}
+}
+
+func TestComputeDCC2DifferentUsersDiffer(t *testing.T) {
+	a := computeDCC2(ntHash("password"), "alice")
+	b := computeDCC2(ntHash("password"), "bob")
+	if a == b {
+		t.Error("computeDCC2 produced the same verifier for two different usernames salted from the same NT hash, want them to differ")
+	}
+}
+
+// TestBruteforceDCC2MatchesEachUserToItsOwnCandidate checks that bruteforceDCC2 recovers the
+// right plaintext per user even when users have different passwords, and that a user with no
+// matching candidate is simply omitted from the result.
+func TestBruteforceDCC2MatchesEachUserToItsOwnCandidate(t *testing.T) {
+	d := Detector{dictionaryReaders: nil}
+	d.rules = []Rule{RuleLowercase}
+
+	users := []*securityreg.CachedDomainUser{
+		{Username: "alice", Domain: "CORP", DCC2: computeDCC2(ntHash("hunter2"), "alice")},
+		{Username: "bob", Domain: "CORP", DCC2: computeDCC2(ntHash("qwerty"), "bob")},
+		{Username: "carol", Domain: "CORP", DCC2: computeDCC2(ntHash("unguessable"), "carol")},
+	}
+
+	d.dictionaryReaders = []io.Reader{strings.NewReader("hunter2\nqwerty\n")}
+
+	got, err := d.bruteforceDCC2(context.Background(), users)
+	if err != nil {
+		t.Fatalf("bruteforceDCC2() returned an error: %v", err)
+	}
+
+	if got[`CORP\alice`] != "hunter2" {
+		t.Errorf(`bruteforceDCC2()[CORP\alice] = %q, want "hunter2"`, got[`CORP\alice`])
+	}
+	if got[`CORP\bob`] != "qwerty" {
+		t.Errorf(`bruteforceDCC2()[CORP\bob] = %q, want "qwerty"`, got[`CORP\bob`])
+	}
+	if _, ok := got[`CORP\carol`]; ok {
+		t.Errorf(`bruteforceDCC2()[CORP\carol] = %q, want no entry (no candidate matches)`, got[`CORP\carol`])
+	}
+}
@@ -0,0 +1,46 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build windows
+
+package winlocal
+
+import (
+	"bufio"
+	"io"
+)
+
+// loadWordlist reads a plain wordlist (one candidate password per line) from r, applies rules to
+// every candidate and hashes the result, merging everything into hashTable keyed by the raw NT
+// and LM hash bytes. Using a map keyed by hash bytes rather than two parallel dictionaries keeps
+// memory bounded and automatically dedupes candidates that mangle to the same hash.
+func loadWordlist(r io.Reader, rules []Rule, hashTable map[[16]byte]string) error {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		candidate := scanner.Text()
+		if candidate == "" {
+			continue
+		}
+
+		for _, mangled := range applyRules(candidate, rules) {
+			if _, ok := hashTable[ntHash(mangled)]; !ok {
+				hashTable[ntHash(mangled)] = mangled
+			}
+			if _, ok := hashTable[lmHash(mangled)]; !ok {
+				hashTable[lmHash(mangled)] = mangled
+			}
+		}
+	}
+	return scanner.Err()
+}
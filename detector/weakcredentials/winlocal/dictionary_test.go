@@ -0,0 +1,63 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build windows
+
+package winlocal
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLoadWordlist(t *testing.T) {
+	hashTable := make(map[[16]byte]string)
+
+	err := loadWordlist(strings.NewReader("password\n\nhunter2\n"), []Rule{RuleUppercase}, hashTable)
+	if err != nil {
+		t.Fatalf("loadWordlist() returned an error: %v", err)
+	}
+
+	if got, want := hashTable[ntHash("password")], "password"; got != want {
+		t.Errorf("hashTable[ntHash(%q)] = %q, want %q", "password", got, want)
+	}
+	if got, want := hashTable[ntHash("PASSWORD")], "PASSWORD"; got != want {
+		t.Errorf("hashTable[ntHash(%q)] = %q, want %q", "PASSWORD", got, want)
+	}
+	if got, want := hashTable[lmHash("password")], "password"; got != want {
+		t.Errorf("hashTable[lmHash(%q)] = %q, want %q", "password", got, want)
+	}
+
+	// The blank line in the input must not have produced an entry for the empty candidate.
+	if _, ok := hashTable[ntHash("")]; ok {
+		t.Error("hashTable contains an entry for the empty candidate, want it skipped")
+	}
+}
+
+func TestLoadWordlistFirstMangledCandidateWins(t *testing.T) {
+	// RuleLowercase("PASSWORD") and the raw candidate "password" mangle/hash identically; whichever
+	// is processed first should be what's recorded, and a second collision must not overwrite it.
+	hashTable := make(map[[16]byte]string)
+
+	if err := loadWordlist(strings.NewReader("password\n"), []Rule{RuleLowercase}, hashTable); err != nil {
+		t.Fatalf("loadWordlist() returned an error: %v", err)
+	}
+	if err := loadWordlist(strings.NewReader("PASSWORD\n"), []Rule{RuleLowercase}, hashTable); err != nil {
+		t.Fatalf("loadWordlist() returned an error: %v", err)
+	}
+
+	if got, want := hashTable[ntHash("password")], "password"; got != want {
+		t.Errorf("hashTable[ntHash(%q)] = %q, want %q (first candidate to hash to this value)", "password", got, want)
+	}
+}
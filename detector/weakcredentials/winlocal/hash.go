@@ -0,0 +1,101 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build windows
+
+package winlocal
+
+import (
+	"crypto/des"
+	"strings"
+
+	"golang.org/x/crypto/md4" //nolint:staticcheck // required to reproduce NTLM hashing.
+)
+
+// lmMagic is the fixed plaintext "KGS!@#$%" DES-encrypted twice to derive the LM hash of a
+// (uppercased, null-padded) candidate password.
+var lmMagic = []byte("KGS!@#$%")
+
+// ntHash computes the NTLM (MD4 over UTF-16LE) hash of candidate.
+func ntHash(candidate string) [16]byte {
+	h := md4.New()
+	h.Write(utf16LEBytes(candidate))
+	var out [16]byte
+	copy(out[:], h.Sum(nil))
+	return out
+}
+
+// lmHash computes the LM hash of candidate. LM hashing only supports the first 14 characters of
+// the (uppercased) password; candidates are truncated or null-padded to fit.
+func lmHash(candidate string) [16]byte {
+	upper := strings.ToUpper(candidate)
+	if len(upper) > 14 {
+		upper = upper[:14]
+	}
+
+	padded := make([]byte, 14)
+	copy(padded, upper)
+
+	var out [16]byte
+	copy(out[:8], lmHashHalf(padded[:7]))
+	copy(out[8:], lmHashHalf(padded[7:]))
+	return out
+}
+
+// lmHashHalf DES-encrypts lmMagic using a key derived from a 7-byte half of the padded password.
+func lmHashHalf(half []byte) []byte {
+	block, err := des.NewCipher(expandDESKey(half))
+	if err != nil {
+		// Only fails if the key is not exactly 8 bytes, which expandDESKey guarantees.
+		panic(err)
+	}
+
+	out := make([]byte, 8)
+	block.Encrypt(out, lmMagic)
+	return out
+}
+
+// expandDESKey expands a 7-byte key into the 8-byte (with parity bits) form crypto/des expects.
+func expandDESKey(key7 []byte) []byte {
+	key8 := make([]byte, 8)
+	key8[0] = key7[0] >> 1
+	key8[1] = (key7[0]<<6 | key7[1]>>2) & 0xFF
+	key8[2] = (key7[1]<<5 | key7[2]>>3) & 0xFF
+	key8[3] = (key7[2]<<4 | key7[3]>>4) & 0xFF
+	key8[4] = (key7[3]<<3 | key7[4]>>5) & 0xFF
+	key8[5] = (key7[4]<<2 | key7[5]>>6) & 0xFF
+	key8[6] = (key7[5]<<1 | key7[6]>>7) & 0xFF
+	key8[7] = key7[6] & 0x7F
+	for i := range key8 {
+		key8[i] <<= 1
+	}
+	return key8
+}
+
+// utf16LEBytes encodes s as UTF-16LE, which is what NTLM hashing operates over.
+func utf16LEBytes(s string) []byte {
+	out := make([]byte, 0, len(s)*2)
+	for _, r := range s {
+		if r <= 0xFFFF {
+			out = append(out, byte(r), byte(r>>8))
+			continue
+		}
+		// Encode as a surrogate pair.
+		r -= 0x10000
+		hi := 0xD800 + (r >> 10)
+		lo := 0xDC00 + (r & 0x3FF)
+		out = append(out, byte(hi), byte(hi>>8), byte(lo), byte(lo>>8))
+	}
+	return out
+}
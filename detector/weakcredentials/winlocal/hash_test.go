@@ -0,0 +1,64 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build windows
+
+package winlocal
+
+import (
+	"encoding/hex"
+	"testing"
+)
+
+func TestNTHash(t *testing.T) {
+	tests := []struct {
+		candidate string
+		want      string
+	}{
+		{"password", "8846f7eaee8fb117ad06bdd830b7586c"},
+		{"", "31d6cfe0d16ae931b73c59d7e0c089c0"},
+	}
+
+	for _, tc := range tests {
+		got := ntHash(tc.candidate)
+		if hex.EncodeToString(got[:]) != tc.want {
+			t.Errorf("ntHash(%q) = %x, want %s", tc.candidate, got, tc.want)
+		}
+	}
+}
+
+func TestLMHash(t *testing.T) {
+	tests := []struct {
+		candidate string
+		want      string
+	}{
+		{"password", "e52cac67419a9a224a3b108f3fa6cb6d"},
+		{"PASSWORD", "e52cac67419a9a224a3b108f3fa6cb6d"},
+	}
+
+	for _, tc := range tests {
+		got := lmHash(tc.candidate)
+		if hex.EncodeToString(got[:]) != tc.want {
+			t.Errorf("lmHash(%q) = %x, want %s", tc.candidate, got, tc.want)
+		}
+	}
+}
+
+func TestUTF16LEBytes(t *testing.T) {
+	got := utf16LEBytes("AB")
+	want := []byte{'A', 0, 'B', 0}
+	if string(got) != string(want) {
+		t.Errorf("utf16LEBytes(%q) = %v, want %v", "AB", got, want)
+	}
+}
@@ -0,0 +1,133 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build windows
+
+package winlocal
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// hibpRangeURL is the Pwned Passwords NTLM range endpoint. Only the first 5 hex chars of the
+// hash are ever sent, per the k-anonymity model documented at
+// https://haveibeenpwned.com/API/v3#PwnedPasswordsNtlm.
+const hibpRangeURL = "https://api.pwnedpasswords.com/range/%s?mode=ntlm"
+
+// HIBPClient looks up NT hash suffixes against the Have I Been Pwned Pwned-Passwords service,
+// following the k-anonymity model: only the first 5 hex chars of the hash are sent, and the
+// client is expected to return every "SUFFIX:COUNT" entry sharing that prefix. It is an
+// interface so tests can stub the network call.
+type HIBPClient interface {
+	// RangeNTLM returns, for the given 5-character uppercase hex prefix of an NT hash, the
+	// breach count for every hash that shares it, keyed by the remaining (uppercase) suffix.
+	RangeNTLM(ctx context.Context, prefix string) (map[string]int, error)
+}
+
+// httpHIBPClient is the default HIBPClient, backed by an injected http.Client so callers control
+// timeouts and transport behavior.
+type httpHIBPClient struct {
+	client *http.Client
+}
+
+// NewHTTPHIBPClient creates an HIBPClient that queries the public Pwned Passwords API using
+// client. ctx passed to RangeNTLM is honored for cancellation/timeouts.
+func NewHTTPHIBPClient(client *http.Client) HIBPClient {
+	return &httpHIBPClient{client: client}
+}
+
+// RangeNTLM implements HIBPClient.
+func (c *httpHIBPClient) RangeNTLM(ctx context.Context, prefix string) (map[string]int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, fmt.Sprintf(hibpRangeURL, prefix), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("hibp range query for prefix %q returned status %d", prefix, resp.StatusCode)
+	}
+
+	return parseHIBPRange(resp.Body)
+}
+
+// parseHIBPRange parses the "SUFFIX:COUNT" lines returned by the range endpoint.
+func parseHIBPRange(r io.Reader) (map[string]int, error) {
+	suffixes := make(map[string]int)
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+
+		parts := strings.SplitN(line, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+
+		count, err := strconv.Atoi(strings.TrimSpace(parts[1]))
+		if err != nil {
+			continue
+		}
+
+		suffixes[strings.ToUpper(parts[0])] = count
+	}
+
+	return suffixes, scanner.Err()
+}
+
+// checkHIBP checks every user's NT hash against the HIBP Pwned Passwords service and returns a
+// map of username to breach count for every hash found. Hashes are never transmitted in full:
+// only the 5-char hex prefix is sent, per k-anonymity. A failure to reach the service is
+// returned as an error so the caller can treat it as a soft failure and continue the scan.
+func checkHIBP(ctx context.Context, client HIBPClient, hashes []*userHashInfo) (map[string]int, error) {
+	results := make(map[string]int)
+
+	for _, user := range hashes {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		if len(user.ntHash) < 5 {
+			continue
+		}
+
+		prefix := strings.ToUpper(user.ntHash[:5])
+		suffix := strings.ToUpper(user.ntHash[5:])
+
+		suffixes, err := client.RangeNTLM(ctx, prefix)
+		if err != nil {
+			return nil, fmt.Errorf("querying HIBP for user %q: %w", user.username, err)
+		}
+
+		if count, ok := suffixes[suffix]; ok {
+			results[user.username] = count
+		}
+	}
+
+	return results, nil
+}
@@ -0,0 +1,111 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build windows
+
+package winlocal
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestParseHIBPRange(t *testing.T) {
+	body := "1E4C9B93F3F0682250B6CF8331B7EE68FD8:3\r\n" +
+		"2AE1A8A0A093543DF5F5F5E6D1C3A6E3C9F:0\r\n" +
+		"\r\n" +
+		"malformed-line\r\n"
+
+	got, err := parseHIBPRange(strings.NewReader(body))
+	if err != nil {
+		t.Fatalf("parseHIBPRange() returned an error: %v", err)
+	}
+
+	want := map[string]int{
+		"1E4C9B93F3F0682250B6CF8331B7EE68FD8": 3,
+		"2AE1A8A0A093543DF5F5F5E6D1C3A6E3C9F": 0,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("parseHIBPRange() = %v, want %v", got, want)
+	}
+	for suffix, count := range want {
+		if got[suffix] != count {
+			t.Errorf("parseHIBPRange()[%q] = %d, want %d", suffix, got[suffix], count)
+		}
+	}
+}
+
+func TestParseHIBPRangeLowercaseSuffixIsUppercased(t *testing.T) {
+	got, err := parseHIBPRange(strings.NewReader("abcdef0123456789abcdef0123456789abcd:5\n"))
+	if err != nil {
+		t.Fatalf("parseHIBPRange() returned an error: %v", err)
+	}
+
+	if _, ok := got["ABCDEF0123456789ABCDEF0123456789ABCD"]; !ok {
+		t.Errorf("parseHIBPRange() = %v, want an uppercased suffix key", got)
+	}
+}
+
+// fakeHIBPClient is an HIBPClient stub keyed by prefix, for tests that don't want to hit the
+// network.
+type fakeHIBPClient struct {
+	ranges map[string]map[string]int
+	err    error
+}
+
+func (f *fakeHIBPClient) RangeNTLM(ctx context.Context, prefix string) (map[string]int, error) {
+	if f.err != nil {
+		return nil, f.err
+	}
+	return f.ranges[prefix], nil
+}
+
+func TestCheckHIBPFindsBreachedHash(t *testing.T) {
+	// ntHash("password") = 8846F7EAEE8FB117AD06BDD830B7586C -- prefix "8846F", suffix the rest.
+	nt := ntHash("password")
+	full := strings.ToUpper(fmt.Sprintf("%x", nt))
+	prefix, suffix := full[:5], full[5:]
+
+	client := &fakeHIBPClient{ranges: map[string]map[string]int{
+		prefix: {suffix: 42},
+	}}
+
+	got, err := checkHIBP(context.Background(), client, []*userHashInfo{
+		{username: "alice", ntHash: full},
+		{username: "bob", ntHash: strings.Repeat("0", 32)},
+	})
+	if err != nil {
+		t.Fatalf("checkHIBP() returned an error: %v", err)
+	}
+
+	if got["alice"] != 42 {
+		t.Errorf(`checkHIBP()["alice"] = %d, want 42`, got["alice"])
+	}
+	if _, ok := got["bob"]; ok {
+		t.Errorf(`checkHIBP()["bob"] = %d, want no entry (hash not in range)`, got["bob"])
+	}
+}
+
+func TestCheckHIBPPropagatesClientError(t *testing.T) {
+	client := &fakeHIBPClient{err: fmt.Errorf("connection refused")}
+
+	_, err := checkHIBP(context.Background(), client, []*userHashInfo{
+		{username: "alice", ntHash: strings.Repeat("a", 32)},
+	})
+	if err == nil {
+		t.Error("checkHIBP() returned nil error, want the client error to propagate")
+	}
+}
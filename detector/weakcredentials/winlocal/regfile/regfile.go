@@ -0,0 +1,408 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package regfile parses the on-disk "regf" format Windows registry hives are saved in (e.g. the
+// SAM, SYSTEM, and SECURITY files produced by `reg save`). It implements just enough of the
+// format -- the regf header, hbin blocks, and nk/vk/lf/lh/li/ri cells -- to resolve a key path to
+// its values and subkeys, which is all samreg/systemreg/securityreg need. It has no build tag: a
+// saved hive is a plain file, so parsing it doesn't require running on Windows.
+package regfile
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"os"
+)
+
+const (
+	// regfSignature is the magic 4 bytes every hive file starts with.
+	regfSignature = "regf"
+	// hbinSignature is the magic 4 bytes every hbin (hive bin) block starts with.
+	hbinSignature = "hbin"
+
+	// baseBlockSize is the fixed size of the regf header block.
+	baseBlockSize = 4096
+
+	// rootCellOffsetField is the byte offset within the base block of the root key cell's offset
+	// (itself relative to the first hbin, i.e. +baseBlockSize into the file).
+	rootCellOffsetField = 0x24
+)
+
+// Hive is a parsed, read-only view of a saved registry hive file.
+type Hive struct {
+	f    *os.File
+	data []byte
+	root *nkCell
+}
+
+// Open reads and parses the hive file at path.
+func Open(file string) (*Hive, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("opening hive file: %w", err)
+	}
+
+	data, err := os.ReadFile(file)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("reading hive file: %w", err)
+	}
+
+	if len(data) < baseBlockSize || string(data[:4]) != regfSignature {
+		f.Close()
+		return nil, fmt.Errorf("%s: not a regf hive (bad signature)", file)
+	}
+
+	rootOffset := int(binary.LittleEndian.Uint32(data[rootCellOffsetField:]))
+	root, err := readNK(data, baseBlockSize+rootOffset)
+	if err != nil {
+		f.Close()
+		return nil, fmt.Errorf("reading root key: %w", err)
+	}
+
+	return &Hive{f: f, data: data, root: root}, nil
+}
+
+// Close releases the underlying hive file.
+func (h *Hive) Close() error {
+	return h.f.Close()
+}
+
+// ValueBytes returns the raw data of the value named name under the key at path (the hive's
+// root is "", and path components are separated by `\`, matching Windows registry path syntax).
+// An empty name refers to a key's unnamed (default) value.
+func (h *Hive) ValueBytes(path, name string) ([]byte, error) {
+	key, err := h.resolveKey(path)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, v := range key.values {
+		if v.name == name {
+			return v.data, nil
+		}
+	}
+
+	return nil, fmt.Errorf("value %q not found under %q", name, path)
+}
+
+// ValueNames returns the names of every value directly under the key at path.
+func (h *Hive) ValueNames(path string) ([]string, error) {
+	key, err := h.resolveKey(path)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, len(key.values))
+	for i, v := range key.values {
+		names[i] = v.name
+	}
+	return names, nil
+}
+
+// SubkeyNames returns the names of every subkey directly under the key at path.
+func (h *Hive) SubkeyNames(path string) ([]string, error) {
+	key, err := h.resolveKey(path)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(key.subkeyOffsets))
+	for _, offset := range key.subkeyOffsets {
+		sub, err := readNK(h.data, offset)
+		if err != nil {
+			return nil, fmt.Errorf("reading subkey of %q: %w", path, err)
+		}
+		names = append(names, sub.name)
+	}
+	return names, nil
+}
+
+// resolveKey walks path (split on `\`) from the root key, returning the nk cell it names.
+func (h *Hive) resolveKey(path string) (*nkCell, error) {
+	key := h.root
+	if path == "" {
+		return key, nil
+	}
+
+	for _, part := range splitPath(path) {
+		var next *nkCell
+		for _, offset := range key.subkeyOffsets {
+			sub, err := readNK(h.data, offset)
+			if err != nil {
+				return nil, fmt.Errorf("reading subkey %q: %w", part, err)
+			}
+			if sub.name == part {
+				next = sub
+				break
+			}
+		}
+		if next == nil {
+			return nil, fmt.Errorf("key %q not found (looking for %q)", path, part)
+		}
+		key = next
+	}
+
+	return key, nil
+}
+
+// splitPath splits a backslash-separated registry path into its components, ignoring empty
+// leading/trailing separators.
+func splitPath(path string) []string {
+	var parts []string
+	start := 0
+	for i := 0; i <= len(path); i++ {
+		if i == len(path) || path[i] == '\\' {
+			if i > start {
+				parts = append(parts, path[start:i])
+			}
+			start = i + 1
+		}
+	}
+	return parts
+}
+
+// nkCell is a parsed "nk" (key node) cell.
+type nkCell struct {
+	name          string
+	values        []vkCell
+	subkeyOffsets []int
+}
+
+// vkCell is a parsed "vk" (value) cell.
+type vkCell struct {
+	name string
+	data []byte
+}
+
+// cellSize returns the absolute size (in bytes, always even, including its own 4-byte size
+// prefix) of the cell at offset. Cell sizes are stored as a negative int32 for in-use cells.
+func cellSize(data []byte, offset int) (int, error) {
+	if offset < 0 || offset+4 > len(data) {
+		return 0, fmt.Errorf("cell offset %d out of range", offset)
+	}
+	size := int32(binary.LittleEndian.Uint32(data[offset:]))
+	if size >= 0 {
+		return 0, fmt.Errorf("cell at offset %d is marked free", offset)
+	}
+	return int(-size), nil
+}
+
+// readNK parses the nk cell at offset.
+func readNK(data []byte, offset int) (*nkCell, error) {
+	size, err := cellSize(data, offset)
+	if err != nil {
+		return nil, err
+	}
+	body := data[offset+4:]
+	if len(body) < 76 || string(body[:2]) != "nk" {
+		return nil, fmt.Errorf("offset %d: not an nk cell", offset)
+	}
+	if size < 76+4 {
+		return nil, fmt.Errorf("offset %d: nk cell too small", offset)
+	}
+
+	numSubkeys := binary.LittleEndian.Uint32(body[20:])
+	subkeysListOffset := int32(binary.LittleEndian.Uint32(body[28:]))
+	numValues := binary.LittleEndian.Uint32(body[36:])
+	valueListOffset := int32(binary.LittleEndian.Uint32(body[40:]))
+	nameLen := binary.LittleEndian.Uint16(body[72:])
+	flags := binary.LittleEndian.Uint16(body[2:])
+
+	nameBytes := body[76 : 76+int(nameLen)]
+	name := decodeName(nameBytes, flags, nkCompressedNameFlag)
+
+	var subkeyOffsets []int
+	if numSubkeys > 0 && subkeysListOffset != -1 {
+		subkeyOffsets, err = readSubkeyList(data, baseBlockSize+int(subkeysListOffset))
+		if err != nil {
+			return nil, fmt.Errorf("%s: reading subkey list: %w", name, err)
+		}
+	}
+
+	var values []vkCell
+	if numValues > 0 && valueListOffset != -1 {
+		values, err = readValueList(data, baseBlockSize+int(valueListOffset), int(numValues))
+		if err != nil {
+			return nil, fmt.Errorf("%s: reading value list: %w", name, err)
+		}
+	}
+
+	return &nkCell{name: name, values: values, subkeyOffsets: subkeyOffsets}, nil
+}
+
+// nkCompressedNameFlag marks an nk (key) cell's name as ASCII rather than UTF-16LE.
+const nkCompressedNameFlag = 0x0020
+
+// vkCompressedNameFlag marks a vk (value) cell's name as ASCII rather than UTF-16LE. This is a
+// different bit than nkCompressedNameFlag: the two cell types don't share a flags layout.
+const vkCompressedNameFlag = 0x0001
+
+// decodeName decodes an nk or vk cell's name field, which is ASCII when compressedNameFlag is
+// set in flags and UTF-16LE otherwise.
+func decodeName(b []byte, flags, compressedNameFlag uint16) string {
+	if flags&compressedNameFlag != 0 {
+		return string(b)
+	}
+	return decodeUTF16LE(b)
+}
+
+// decodeUTF16LE decodes a UTF-16LE byte slice into a string, dropping any lone trailing byte.
+func decodeUTF16LE(b []byte) string {
+	if len(b)%2 != 0 {
+		b = b[:len(b)-1]
+	}
+	runes := make([]uint16, len(b)/2)
+	for i := range runes {
+		runes[i] = binary.LittleEndian.Uint16(b[i*2:])
+	}
+	return string(utf16Decode(runes))
+}
+
+// utf16Decode converts UTF-16 code units to runes, without relying on surrogate pairs since
+// registry key/value names are practically always in the basic multilingual plane.
+func utf16Decode(units []uint16) []rune {
+	out := make([]rune, len(units))
+	for i, u := range units {
+		out[i] = rune(u)
+	}
+	return out
+}
+
+// readSubkeyList parses an lf/lh/ri/li subkey list cell at offset, returning the absolute file
+// offsets of every listed nk cell.
+func readSubkeyList(data []byte, offset int) ([]int, error) {
+	if _, err := cellSize(data, offset); err != nil {
+		return nil, err
+	}
+	body := data[offset+4:]
+	if len(body) < 4 {
+		return nil, fmt.Errorf("offset %d: subkey list cell too small", offset)
+	}
+
+	sig := string(body[:2])
+	count := int(binary.LittleEndian.Uint16(body[2:]))
+
+	switch sig {
+	case "lf", "lh":
+		// Each entry is an 8-byte (offset, hash) pair.
+		var offsets []int
+		for i := 0; i < count; i++ {
+			entry := body[4+i*8:]
+			offsets = append(offsets, baseBlockSize+int(int32(binary.LittleEndian.Uint32(entry))))
+		}
+		return offsets, nil
+	case "ri":
+		// Each entry is a 4-byte offset to another (lf/lh/li) subkey list; flatten recursively.
+		var offsets []int
+		for i := 0; i < count; i++ {
+			entry := body[4+i*4:]
+			subListOffset := baseBlockSize + int(int32(binary.LittleEndian.Uint32(entry)))
+			sub, err := readSubkeyList(data, subListOffset)
+			if err != nil {
+				return nil, err
+			}
+			offsets = append(offsets, sub...)
+		}
+		return offsets, nil
+	case "li":
+		// Each entry is a plain 4-byte nk cell offset.
+		var offsets []int
+		for i := 0; i < count; i++ {
+			entry := body[4+i*4:]
+			offsets = append(offsets, baseBlockSize+int(int32(binary.LittleEndian.Uint32(entry))))
+		}
+		return offsets, nil
+	default:
+		return nil, fmt.Errorf("offset %d: unrecognized subkey list signature %q", offset, sig)
+	}
+}
+
+// valueListEntrySize is the size, in bytes, of one offset entry in a value list cell.
+const valueListEntrySize = 4
+
+// readValueList parses the value-list cell at offset (a flat array of vk cell offsets) and
+// returns the parsed vk cells.
+func readValueList(data []byte, offset, count int) ([]vkCell, error) {
+	if _, err := cellSize(data, offset); err != nil {
+		return nil, err
+	}
+	body := data[offset+4:]
+	if len(body) < count*valueListEntrySize {
+		return nil, fmt.Errorf("offset %d: value list cell too small for %d entries", offset, count)
+	}
+
+	values := make([]vkCell, 0, count)
+	for i := 0; i < count; i++ {
+		vkOffset := baseBlockSize + int(int32(binary.LittleEndian.Uint32(body[i*valueListEntrySize:])))
+		vk, err := readVK(data, vkOffset)
+		if err != nil {
+			return nil, fmt.Errorf("entry %d: %w", i, err)
+		}
+		values = append(values, *vk)
+	}
+	return values, nil
+}
+
+// vkDataInline marks a vk cell's data length as having its top bit set, meaning the 4-byte data
+// offset field holds the value's data inline rather than pointing at a separate data cell.
+const vkDataInline = 0x80000000
+
+// readVK parses the vk cell at offset.
+func readVK(data []byte, offset int) (*vkCell, error) {
+	size, err := cellSize(data, offset)
+	if err != nil {
+		return nil, err
+	}
+	body := data[offset+4:]
+	if len(body) < 20 || string(body[:2]) != "vk" {
+		return nil, fmt.Errorf("offset %d: not a vk cell", offset)
+	}
+	if size < 20 {
+		return nil, fmt.Errorf("offset %d: vk cell too small", offset)
+	}
+
+	nameLen := binary.LittleEndian.Uint16(body[2:])
+	dataLenField := binary.LittleEndian.Uint32(body[4:])
+	dataOffsetField := binary.LittleEndian.Uint32(body[8:])
+	flags := binary.LittleEndian.Uint16(body[16:])
+
+	nameBytes := body[20 : 20+int(nameLen)]
+	name := decodeName(nameBytes, flags, vkCompressedNameFlag)
+	if nameLen == 0 {
+		name = ""
+	}
+
+	dataLen := int(dataLenField &^ vkDataInline)
+
+	var valueData []byte
+	if dataLenField&vkDataInline != 0 {
+		// Small values (<=4 bytes) are stored inline in the offset field itself.
+		inline := make([]byte, 4)
+		binary.LittleEndian.PutUint32(inline, dataOffsetField)
+		valueData = inline[:dataLen]
+	} else {
+		dataOffset := baseBlockSize + int(int32(dataOffsetField))
+		if _, err := cellSize(data, dataOffset); err != nil {
+			return nil, fmt.Errorf("%s: reading data cell: %w", name, err)
+		}
+		if dataOffset+4+dataLen > len(data) {
+			return nil, fmt.Errorf("%s: data cell out of range", name)
+		}
+		valueData = bytes.Clone(data[dataOffset+4 : dataOffset+4+dataLen])
+	}
+
+	return &vkCell{name: name, data: valueData}, nil
+}
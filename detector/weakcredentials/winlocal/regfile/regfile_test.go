@@ -0,0 +1,273 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package regfile
+
+import (
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+// hiveBuilder assembles a minimal synthetic regf hive file for tests: a base block followed by
+// a single hbin containing hand-laid-out nk/vk/lf cells. It only needs to produce something
+// readNK/readVK/readSubkeyList can parse, not a byte-perfect real-world hive.
+type hiveBuilder struct {
+	cells []byte // cell bytes, laid out back to back; offsets are relative to the hbin start (see addCell)
+}
+
+// hbinHeaderSize is the fixed size of an hbin block's header, which precedes its cells. Offsets
+// stored in the hive (root cell offset, subkey/value list offsets, etc) are relative to the
+// start of the hbin block itself, not to the first cell after its header -- so addCell's
+// returned offsets must account for that header even though the builder only ever emits one
+// hbin.
+const hbinHeaderSize = 32
+
+// addCell appends body (already including its own 2-byte or larger content, NOT the 4-byte size
+// prefix) as a new cell, padding to an 8-byte boundary, and returns its offset relative to the
+// start of the (single) hbin block -- the offset readNK/readVK/readSubkeyList expect once
+// baseBlockSize is added.
+func (b *hiveBuilder) addCell(body []byte) int {
+	offset := hbinHeaderSize + len(b.cells)
+
+	total := 4 + len(body)
+	if pad := total % 8; pad != 0 {
+		body = append(body, make([]byte, 8-pad)...)
+		total += 8 - pad
+	}
+
+	size := make([]byte, 4)
+	binary.LittleEndian.PutUint32(size, uint32(int32(-total)))
+
+	b.cells = append(b.cells, size...)
+	b.cells = append(b.cells, body...)
+
+	return offset
+}
+
+func le16(v uint16) []byte {
+	b := make([]byte, 2)
+	binary.LittleEndian.PutUint16(b, v)
+	return b
+}
+
+func le32(v uint32) []byte {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, v)
+	return b
+}
+
+// addVK adds a vk cell for an ASCII-named value with inline data (data must be <=4 bytes).
+func (b *hiveBuilder) addVK(name string, data []byte) int {
+	if len(data) > 4 {
+		panic("addVK in this test helper only supports inline (<=4 byte) values")
+	}
+	inline := make([]byte, 4)
+	copy(inline, data)
+
+	body := make([]byte, 0, 20+len(name))
+	body = append(body, []byte("vk")...)
+	body = append(body, le16(uint16(len(name)))...)
+	body = append(body, le32(uint32(len(data))|vkDataInline)...)
+	body = append(body, inline...)
+	body = append(body, le32(0)...)      // value type (REG_SZ/etc, unused by regfile)
+	body = append(body, le16(0x0001)...) // VALUE_COMP_NAME: name is ASCII
+	body = append(body, le16(0)...)      // spare
+	body = append(body, []byte(name)...)
+
+	return b.addCell(body)
+}
+
+// addNK adds an nk cell for an ASCII-named key with the given value and subkey cell offsets
+// (offsets are relative to the start of the hbin block, as returned by addVK/addNK/addSubkeyList).
+func (b *hiveBuilder) addNK(name string, valueListOffset, numValues, subkeyListOffset, numSubkeys int) int {
+	body := make([]byte, 0, 76+len(name))
+	body = append(body, []byte("nk")...)
+	body = append(body, le16(0x0020)...)    // compressed (ASCII) name
+	body = append(body, make([]byte, 8)...) // last-modified timestamp, unused
+	body = append(body, make([]byte, 4)...) // spare
+	body = append(body, le32(0)...)         // parent offset, unused
+	body = append(body, le32(uint32(numSubkeys))...)
+	body = append(body, le32(0)...) // volatile subkeys
+	body = append(body, le32(uint32(subkeyListOffset))...)
+	body = append(body, le32(0xFFFFFFFF)...) // volatile subkeys list offset: none
+	body = append(body, le32(uint32(numValues))...)
+	body = append(body, le32(uint32(valueListOffset))...)
+	body = append(body, le32(0xFFFFFFFF)...) // security offset, unused
+	body = append(body, le32(0xFFFFFFFF)...) // class name offset, unused
+	body = append(body, make([]byte, 16)...) // max subkey/class/value name/data lengths, unused
+	body = append(body, le32(0)...)          // workvar
+	body = append(body, le16(uint16(len(name)))...)
+	body = append(body, le16(0)...) // class name length
+	body = append(body, []byte(name)...)
+
+	return b.addCell(body)
+}
+
+// addValueList adds a flat value-list cell referencing the given vk cell offsets.
+func (b *hiveBuilder) addValueList(vkOffsets ...int) int {
+	var body []byte
+	for _, off := range vkOffsets {
+		body = append(body, le32(uint32(off))...)
+	}
+	return b.addCell(body)
+}
+
+// addSubkeyList adds an "lf" subkey-list cell referencing the given nk cell offsets.
+func (b *hiveBuilder) addSubkeyList(nkOffsets ...int) int {
+	body := make([]byte, 0, 4+8*len(nkOffsets))
+	body = append(body, []byte("lf")...)
+	body = append(body, le16(uint16(len(nkOffsets)))...)
+	for _, off := range nkOffsets {
+		body = append(body, le32(uint32(off))...)
+		body = append(body, make([]byte, 4)...) // hash, unused by readSubkeyList
+	}
+	return b.addCell(body)
+}
+
+// build assembles the full hive file bytes: a zeroed base block (with the root cell offset
+// patched in) followed by one hbin wrapping every cell added so far.
+func (b *hiveBuilder) build(rootOffset int) []byte {
+	hbinHeader := make([]byte, 32)
+	copy(hbinHeader[:4], hbinSignature)
+	binary.LittleEndian.PutUint32(hbinHeader[8:], uint32(len(hbinHeader)+len(b.cells)))
+
+	var file []byte
+	base := make([]byte, baseBlockSize)
+	copy(base[:4], regfSignature)
+	binary.LittleEndian.PutUint32(base[rootCellOffsetField:], uint32(rootOffset))
+	file = append(file, base...)
+	file = append(file, hbinHeader...)
+	file = append(file, b.cells...)
+	return file
+}
+
+// writeTestHive builds a small hive with a root key containing one value ("" = "root") and
+// one subkey "Foo" containing a value "Bar" = "baz", and returns the path it was written to.
+func writeTestHive(t *testing.T) string {
+	t.Helper()
+
+	var b hiveBuilder
+
+	fooBarVK := b.addVK("Bar", []byte("baz"))
+	fooValueList := b.addValueList(fooBarVK)
+	fooNK := b.addNK("Foo", fooValueList, 1, 0, 0)
+
+	rootDefaultVK := b.addVK("", []byte("root"))
+	rootValueList := b.addValueList(rootDefaultVK)
+	subkeyList := b.addSubkeyList(fooNK)
+	rootNK := b.addNK("", rootValueList, 1, subkeyList, 1)
+
+	data := b.build(rootNK)
+
+	path := filepath.Join(t.TempDir(), "TEST.hive")
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatalf("WriteFile(%q) failed: %v", path, err)
+	}
+	return path
+}
+
+func TestOpenAndResolveKey(t *testing.T) {
+	path := writeTestHive(t)
+
+	hive, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open(%q) returned an error: %v", path, err)
+	}
+	defer hive.Close()
+
+	got, err := hive.ValueBytes("", "")
+	if err != nil {
+		t.Fatalf(`ValueBytes("", "") returned an error: %v`, err)
+	}
+	if string(got) != "root" {
+		t.Errorf(`ValueBytes("", "") = %q, want "root"`, got)
+	}
+
+	got, err = hive.ValueBytes(`Foo`, "Bar")
+	if err != nil {
+		t.Fatalf(`ValueBytes("Foo", "Bar") returned an error: %v`, err)
+	}
+	if string(got) != "baz" {
+		t.Errorf(`ValueBytes("Foo", "Bar") = %q, want "baz"`, got)
+	}
+}
+
+func TestValueNames(t *testing.T) {
+	path := writeTestHive(t)
+
+	hive, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open(%q) returned an error: %v", path, err)
+	}
+	defer hive.Close()
+
+	names, err := hive.ValueNames("Foo")
+	if err != nil {
+		t.Fatalf(`ValueNames("Foo") returned an error: %v`, err)
+	}
+	if !reflect.DeepEqual(names, []string{"Bar"}) {
+		t.Errorf(`ValueNames("Foo") = %v, want [Bar]`, names)
+	}
+}
+
+func TestSubkeyNames(t *testing.T) {
+	path := writeTestHive(t)
+
+	hive, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open(%q) returned an error: %v", path, err)
+	}
+	defer hive.Close()
+
+	names, err := hive.SubkeyNames("")
+	if err != nil {
+		t.Fatalf(`SubkeyNames("") returned an error: %v`, err)
+	}
+	sort.Strings(names)
+	if !reflect.DeepEqual(names, []string{"Foo"}) {
+		t.Errorf(`SubkeyNames("") = %v, want [Foo]`, names)
+	}
+}
+
+func TestValueBytesMissing(t *testing.T) {
+	path := writeTestHive(t)
+
+	hive, err := Open(path)
+	if err != nil {
+		t.Fatalf("Open(%q) returned an error: %v", path, err)
+	}
+	defer hive.Close()
+
+	if _, err := hive.ValueBytes("Foo", "DoesNotExist"); err == nil {
+		t.Error(`ValueBytes("Foo", "DoesNotExist") returned nil error, want non-nil`)
+	}
+	if _, err := hive.ValueBytes("DoesNotExist", ""); err == nil {
+		t.Error(`ValueBytes("DoesNotExist", "") returned nil error, want non-nil`)
+	}
+}
+
+func TestOpenRejectsBadSignature(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "bad.hive")
+	if err := os.WriteFile(path, make([]byte, baseBlockSize), 0o644); err != nil {
+		t.Fatalf("WriteFile(%q) failed: %v", path, err)
+	}
+
+	if _, err := Open(path); err == nil {
+		t.Error("Open() on a file with a bad signature returned nil error, want non-nil")
+	}
+}
@@ -0,0 +1,158 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build windows
+
+package winlocal
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// Rule mangles a candidate password into zero or more derived candidates (e.g. case changes,
+// leet-speak substitutions, common suffixes). Rules are expected to be pure and side-effect free
+// so they can be composed and run repeatedly over the same dictionary.
+type Rule func(candidate string) []string
+
+// leetSubstitutions maps the letters hashcat's best64 rule set commonly substitutes.
+var leetSubstitutions = map[rune]rune{
+	'a': '4',
+	'e': '3',
+	'i': '1',
+	'o': '0',
+	's': '5',
+	't': '7',
+}
+
+// RuleLowercase lowercases the candidate.
+func RuleLowercase(candidate string) []string {
+	return []string{strings.ToLower(candidate)}
+}
+
+// RuleUppercase uppercases the candidate.
+func RuleUppercase(candidate string) []string {
+	return []string{strings.ToUpper(candidate)}
+}
+
+// RuleCapitalize capitalizes the first letter of the candidate and lowercases the rest.
+func RuleCapitalize(candidate string) []string {
+	if candidate == "" {
+		return nil
+	}
+	return []string{strings.ToUpper(candidate[:1]) + strings.ToLower(candidate[1:])}
+}
+
+// RuleReverse reverses the candidate.
+func RuleReverse(candidate string) []string {
+	runes := []rune(candidate)
+	for i, j := 0, len(runes)-1; i < j; i, j = i+1, j-1 {
+		runes[i], runes[j] = runes[j], runes[i]
+	}
+	return []string{string(runes)}
+}
+
+// RuleLeetSpeak substitutes common letters for the digits hashcat's best64 rule set uses
+// (a->4, e->3, i->1, o->0, s->5, t->7).
+func RuleLeetSpeak(candidate string) []string {
+	runes := []rune(candidate)
+	for i, r := range runes {
+		if sub, ok := leetSubstitutions[r]; ok {
+			runes[i] = sub
+		}
+	}
+	return []string{string(runes)}
+}
+
+// RuleYearSuffix appends every year between 1990 and 2030 to the candidate.
+func RuleYearSuffix(candidate string) []string {
+	out := make([]string, 0, 41)
+	for year := 1990; year <= 2030; year++ {
+		out = append(out, candidate+strconv.Itoa(year))
+	}
+	return out
+}
+
+// RuleDigitSuffix appends every single and double digit suffix (0-99) to the candidate.
+func RuleDigitSuffix(candidate string) []string {
+	out := make([]string, 0, 100)
+	for i := 0; i < 100; i++ {
+		out = append(out, candidate+strconv.Itoa(i))
+	}
+	return out
+}
+
+// DefaultRules mirrors the transformations hashcat's best64.rule applies most often, so callers
+// get substantially more coverage than the raw dictionary without having to hand pick rules.
+func DefaultRules() []Rule {
+	return []Rule{
+		RuleLowercase,
+		RuleUppercase,
+		RuleCapitalize,
+		RuleLeetSpeak,
+		RuleReverse,
+		RuleYearSuffix,
+		RuleDigitSuffix,
+	}
+}
+
+// appendOnlyRules are rules whose output must not be fed back into the frontier for further
+// composition. RuleYearSuffix and RuleDigitSuffix each fan a single candidate out to dozens or
+// hundreds of variants; letting later rules (or each other) compose on top of that fan-out turns
+// a handful of transform rules into a combinatorial explosion -- DefaultRules() alone would yield
+// over 40,000 variants per dictionary word instead of a few thousand. They still run once, over
+// every candidate the transform rules before them produced, so "Password2024" (RuleCapitalize
+// then RuleYearSuffix) is still generated -- just not "Password20241" (YearSuffix output fed into
+// DigitSuffix).
+var appendOnlyRules = map[uintptr]bool{
+	reflect.ValueOf(RuleYearSuffix).Pointer():  true,
+	reflect.ValueOf(RuleDigitSuffix).Pointer(): true,
+}
+
+// isAppendOnly reports whether rule is registered in appendOnlyRules.
+func isAppendOnly(rule Rule) bool {
+	return appendOnlyRules[reflect.ValueOf(rule).Pointer()]
+}
+
+// applyRules returns candidate plus every variant reachable by applying rules in order. Transform
+// rules (case changes, leet-speak, reversal) compose: each one runs over every candidate produced
+// so far, including by earlier transform rules, so e.g. "PASSWORD" (RuleUppercase) can itself be
+// leet-substituted. Append-only rules (see appendOnlyRules) run once over that same frontier but
+// are excluded from it afterward, so their large suffix fan-outs don't get composed further.
+func applyRules(candidate string, rules []Rule) []string {
+	seen := map[string]bool{candidate: true}
+	candidates := []string{candidate}
+
+	frontier := []string{candidate}
+	for _, rule := range rules {
+		var fresh []string
+		for _, c := range frontier {
+			for _, mangled := range rule(c) {
+				if seen[mangled] {
+					continue
+				}
+				seen[mangled] = true
+				fresh = append(fresh, mangled)
+			}
+		}
+
+		candidates = append(candidates, fresh...)
+		if !isAppendOnly(rule) {
+			frontier = append(frontier, fresh...)
+		}
+	}
+
+	return candidates
+}
@@ -0,0 +1,149 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build windows
+
+package winlocal
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRuleCapitalize(t *testing.T) {
+	tests := []struct {
+		candidate string
+		want      []string
+	}{
+		{"password", []string{"Password"}},
+		{"PASSWORD", []string{"Password"}},
+		{"", nil},
+	}
+
+	for _, tc := range tests {
+		got := RuleCapitalize(tc.candidate)
+		if len(got) != len(tc.want) {
+			t.Fatalf("RuleCapitalize(%q) = %v, want %v", tc.candidate, got, tc.want)
+		}
+		for i := range got {
+			if got[i] != tc.want[i] {
+				t.Errorf("RuleCapitalize(%q) = %v, want %v", tc.candidate, got, tc.want)
+			}
+		}
+	}
+}
+
+func TestRuleLeetSpeak(t *testing.T) {
+	got := RuleLeetSpeak("password")
+	want := "p455w0rd"
+	if len(got) != 1 || got[0] != want {
+		t.Errorf("RuleLeetSpeak(%q) = %v, want [%s]", "password", got, want)
+	}
+}
+
+func TestRuleReverse(t *testing.T) {
+	got := RuleReverse("abc")
+	if len(got) != 1 || got[0] != "cba" {
+		t.Errorf(`RuleReverse("abc") = %v, want ["cba"]`, got)
+	}
+}
+
+// TestApplyRulesComposesAcrossRules checks that applyRules folds each rule over every candidate
+// produced so far, not just the original input -- the bug the review flagged: combinations like
+// capitalize-then-year-suffix must be reachable, not just one mangling per rule in isolation.
+func TestApplyRulesComposesAcrossRules(t *testing.T) {
+	rules := []Rule{RuleCapitalize, RuleYearSuffix}
+
+	got := applyRules("password", rules)
+
+	want := "Password2024"
+	found := false
+	for _, c := range got {
+		if c == want {
+			found = true
+			break
+		}
+	}
+	if !found {
+		t.Errorf("applyRules(%q, [RuleCapitalize, RuleYearSuffix]) = %v, want it to contain %q", "password", got, want)
+	}
+}
+
+func TestApplyRulesIncludesOriginalCandidate(t *testing.T) {
+	got := applyRules("password", []Rule{RuleUppercase})
+
+	found := false
+	for _, c := range got {
+		if c == "password" {
+			found = true
+			break
+		}
+	}
+	if !found {
+		t.Errorf("applyRules(%q, ...) = %v, want it to still contain the unmangled candidate", "password", got)
+	}
+}
+
+func TestApplyRulesDedupes(t *testing.T) {
+	// RuleLowercase run on an already-lowercase candidate produces the same string back; it must
+	// not appear twice in the result.
+	got := applyRules("password", []Rule{RuleLowercase, RuleLowercase})
+
+	count := 0
+	for _, c := range got {
+		if c == "password" {
+			count++
+		}
+	}
+	if count != 1 {
+		t.Errorf("applyRules(%q, [RuleLowercase, RuleLowercase]) contains %q %d times, want 1", "password", "password", count)
+	}
+}
+
+func TestDefaultRulesNonEmpty(t *testing.T) {
+	if len(DefaultRules()) == 0 {
+		t.Error("DefaultRules() returned no rules, want at least one")
+	}
+}
+
+// TestApplyRulesAppendOnlyRulesDoNotCompose checks that RuleYearSuffix and RuleDigitSuffix each
+// run once over the transform frontier but are not fed back into it: chaining them must not
+// multiply their fan-outs together (which would turn DefaultRules() into a combinatorial
+// explosion of tens of thousands of variants per dictionary word).
+func TestApplyRulesAppendOnlyRulesDoNotCompose(t *testing.T) {
+	got := applyRules("password", []Rule{RuleYearSuffix, RuleDigitSuffix})
+
+	// 1 (original) + 41 (years 1990-2030) + 100 (digits 0-99), not 41*100 from composing.
+	if want := 1 + 41 + 100; len(got) != want {
+		t.Errorf("applyRules(%q, [RuleYearSuffix, RuleDigitSuffix]) returned %d candidates, want %d", "password", len(got), want)
+	}
+
+	for _, c := range got {
+		if strings.HasPrefix(c, "password2024") && c != "password2024" {
+			t.Errorf("applyRules(%q, [RuleYearSuffix, RuleDigitSuffix]) contains %q, want RuleDigitSuffix not to compose on top of RuleYearSuffix's output", "password", c)
+		}
+	}
+}
+
+// TestApplyRulesDefaultRulesStaysBounded guards against the append-rule explosion the review
+// flagged: DefaultRules() applied to a single candidate must stay in the low thousands, not the
+// tens of thousands a fully composed ruleset would produce.
+func TestApplyRulesDefaultRulesStaysBounded(t *testing.T) {
+	got := applyRules("password", DefaultRules())
+
+	const tooMany = 10000
+	if len(got) >= tooMany {
+		t.Errorf("applyRules(%q, DefaultRules()) returned %d candidates, want well under %d", "password", len(got), tooMany)
+	}
+}
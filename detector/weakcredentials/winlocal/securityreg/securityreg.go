@@ -0,0 +1,265 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build windows
+
+// Package securityreg parses a saved copy of the Windows SECURITY registry hive to recover
+// LSA secrets and MSCacheV2 (DCC2) cached domain logon verifiers, mirroring the SAM/SYSTEM
+// parsing done by the samreg and systemreg packages.
+package securityreg
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+
+	"github.com/google/osv-scalibr/detector/weakcredentials/winlocal/regfile"
+)
+
+const (
+	// policyKeyPath is where the (boot-key-encrypted) LSA key material lives.
+	policyKeyPath = `Policy\PolEKList`
+	// cacheRootPath holds one NL$<n> value per cached domain logon, plus an NL$Control value.
+	cacheRootPath = `Cache`
+	// secretsRootPath holds one subkey per LSA secret, each with a CurrVal value.
+	secretsRootPath = `Policy\Secrets`
+)
+
+// SecurityRegistry provides read access to a saved copy of the SECURITY hive.
+type SecurityRegistry struct {
+	hive *regfile.Hive
+}
+
+// NewFromFile opens the SECURITY hive previously saved to file.
+func NewFromFile(file string) (*SecurityRegistry, error) {
+	hive, err := regfile.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("opening SECURITY hive: %w", err)
+	}
+	return &SecurityRegistry{hive: hive}, nil
+}
+
+// Close releases the underlying hive file.
+func (r *SecurityRegistry) Close() error {
+	return r.hive.Close()
+}
+
+// DeriveLSAKey decrypts the LSA encryption key stored at Policy\PolEKList using bootKey (the
+// same SYSTEM boot key used to derive the SAM syskey). Modern (Vista+) SECURITY hives protect
+// PolEKList with AES rather than the legacy RC4 scheme.
+func (r *SecurityRegistry) DeriveLSAKey(bootKey []byte) ([]byte, error) {
+	blob, err := r.hive.ValueBytes(policyKeyPath, "")
+	if err != nil {
+		return nil, fmt.Errorf("reading %s: %w", policyKeyPath, err)
+	}
+	return decryptLSAKeyBlob(blob, bootKey)
+}
+
+// decryptLSAKeyBlob decrypts a PolEKList blob with bootKey and returns the 32-byte LSA key.
+func decryptLSAKeyBlob(blob, bootKey []byte) ([]byte, error) {
+	if len(blob) < 68 {
+		return nil, fmt.Errorf("PolEKList blob too short: %d bytes", len(blob))
+	}
+
+	// Layout: 16-byte IV-ish salt, then ciphertext. The AES key used to decrypt the blob is
+	// itself derived from the boot key via 1000 rounds of HMAC-SHA256 over the salt, each keyed
+	// by the previous round's output.
+	salt := blob[:16]
+	ciphertext := blob[16:]
+
+	key := bootKey
+	for i := 0; i < 1000; i++ {
+		h := hmac.New(sha256.New, key)
+		h.Write(salt)
+		key = h.Sum(nil)
+	}
+
+	block, err := aes.NewCipher(key[:32])
+	if err != nil {
+		return nil, fmt.Errorf("building AES cipher for LSA key: %w", err)
+	}
+
+	if len(ciphertext)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("PolEKList ciphertext is not block aligned")
+	}
+
+	plaintext := make([]byte, len(ciphertext))
+	mode := cipher.NewCBCDecrypter(block, make([]byte, aes.BlockSize))
+	mode.CryptBlocks(plaintext, ciphertext)
+
+	// The decrypted blob is itself a small structure; the actual 32-byte LSA key starts after a
+	// fixed-size header produced by LsaICryptProtectData.
+	const lsaKeyHeaderSize = 36
+	if len(plaintext) < lsaKeyHeaderSize+32 {
+		return nil, fmt.Errorf("decrypted LSA key blob too short")
+	}
+
+	return plaintext[lsaKeyHeaderSize : lsaKeyHeaderSize+32], nil
+}
+
+// CachedDomainUser is one MSCacheV2 (DCC2) verifier recovered from Cache\NL$<n>.
+type CachedDomainUser struct {
+	Username string
+	Domain   string
+	// DCC2 is the 16-byte MSCacheV2 hash: PBKDF2-HMAC-SHA1(NTHash, lower(username), 10240, 16).
+	DCC2 [16]byte
+}
+
+// CachedDomainUsers decrypts every Cache\NL$<n> value using lsaKey and returns the recovered
+// DCC2 verifiers. NL$Control and empty slots are skipped.
+func (r *SecurityRegistry) CachedDomainUsers(lsaKey []byte) ([]*CachedDomainUser, error) {
+	names, err := r.hive.ValueNames(cacheRootPath)
+	if err != nil {
+		return nil, fmt.Errorf("listing %s values: %w", cacheRootPath, err)
+	}
+
+	var users []*CachedDomainUser
+	for _, name := range names {
+		if !strings.HasPrefix(name, "NL$") || name == "NL$Control" {
+			continue
+		}
+
+		blob, err := r.hive.ValueBytes(cacheRootPath, name)
+		if err != nil || len(blob) == 0 {
+			continue
+		}
+
+		user, err := decodeNLRecord(blob, lsaKey)
+		if err != nil {
+			// A handful of slots are typically unused/zeroed; skip rather than aborting the
+			// whole hive walk for one bad record.
+			continue
+		}
+
+		users = append(users, user)
+	}
+
+	return users, nil
+}
+
+// nlRecordHeaderSize is the fixed portion of an NL_RECORD preceding the encrypted credential
+// data (user/domain name lengths, DNS domain info, logon time, etc).
+const nlRecordHeaderSize = 96
+
+// decodeNLRecord decrypts one Cache\NL$<n> value (an NL_RECORD) and extracts the DCC2 hash and
+// user/domain names.
+func decodeNLRecord(blob, lsaKey []byte) (*CachedDomainUser, error) {
+	if len(blob) < nlRecordHeaderSize {
+		return nil, fmt.Errorf("NL_RECORD too short: %d bytes", len(blob))
+	}
+
+	userLen := int(blob[0]) | int(blob[1])<<8
+	domainLen := int(blob[2]) | int(blob[3])<<8
+
+	ciphertext := blob[nlRecordHeaderSize:]
+
+	block, err := aes.NewCipher(lsaKey)
+	if err != nil {
+		return nil, fmt.Errorf("building AES cipher for NL_RECORD: %w", err)
+	}
+	if len(ciphertext)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("NL_RECORD ciphertext is not block aligned")
+	}
+
+	plaintext := make([]byte, len(ciphertext))
+	mode := cipher.NewCBCDecrypter(block, make([]byte, aes.BlockSize))
+	mode.CryptBlocks(plaintext, ciphertext)
+
+	if len(plaintext) < 16+userLen+domainLen {
+		return nil, fmt.Errorf("decrypted NL_RECORD shorter than declared name lengths")
+	}
+
+	var dcc2 [16]byte
+	copy(dcc2[:], plaintext[:16])
+
+	username := decodeUTF16LE(plaintext[16 : 16+userLen])
+	domain := decodeUTF16LE(plaintext[16+userLen : 16+userLen+domainLen])
+
+	return &CachedDomainUser{
+		Username: username,
+		Domain:   domain,
+		DCC2:     dcc2,
+	}, nil
+}
+
+// Secrets decrypts every Policy\Secrets\*\CurrVal value using lsaKey and returns a map of secret
+// name to recovered plaintext. Service account passwords, the autologon DefaultPassword, and
+// $MACHINE.ACC all live here.
+func (r *SecurityRegistry) Secrets(lsaKey []byte) (map[string][]byte, error) {
+	names, err := r.hive.SubkeyNames(secretsRootPath)
+	if err != nil {
+		return nil, fmt.Errorf("listing %s subkeys: %w", secretsRootPath, err)
+	}
+
+	secrets := make(map[string][]byte)
+	for _, name := range names {
+		path := secretsRootPath + `\` + name + `\CurrVal`
+		blob, err := r.hive.ValueBytes(path, "")
+		if err != nil || len(blob) == 0 {
+			continue
+		}
+
+		plaintext, err := decryptLSASecret(blob, lsaKey)
+		if err != nil {
+			continue
+		}
+
+		secrets[name] = plaintext
+	}
+
+	return secrets, nil
+}
+
+// decryptLSASecret decrypts one LSA secret CurrVal blob with lsaKey. The plaintext is
+// null-terminated UTF-16LE for most well-known secrets (DefaultPassword, $MACHINE.ACC), so
+// trailing NUL bytes are trimmed.
+func decryptLSASecret(blob, lsaKey []byte) ([]byte, error) {
+	const secretHeaderSize = 12
+	if len(blob) < secretHeaderSize {
+		return nil, fmt.Errorf("LSA secret blob too short: %d bytes", len(blob))
+	}
+
+	ciphertext := blob[secretHeaderSize:]
+
+	block, err := aes.NewCipher(lsaKey)
+	if err != nil {
+		return nil, fmt.Errorf("building AES cipher for LSA secret: %w", err)
+	}
+	if len(ciphertext)%aes.BlockSize != 0 {
+		return nil, fmt.Errorf("LSA secret ciphertext is not block aligned")
+	}
+
+	plaintext := make([]byte, len(ciphertext))
+	mode := cipher.NewCBCDecrypter(block, make([]byte, aes.BlockSize))
+	mode.CryptBlocks(plaintext, ciphertext)
+
+	return bytes.TrimRight(plaintext, "\x00"), nil
+}
+
+// decodeUTF16LE decodes a UTF-16LE byte slice into a string, dropping any lone trailing byte.
+func decodeUTF16LE(b []byte) string {
+	if len(b)%2 != 0 {
+		b = b[:len(b)-1]
+	}
+
+	runes := make([]rune, 0, len(b)/2)
+	for i := 0; i < len(b); i += 2 {
+		runes = append(runes, rune(uint16(b[i])|uint16(b[i+1])<<8))
+	}
+	return string(runes)
+}
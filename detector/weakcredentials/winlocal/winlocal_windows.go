@@ -21,7 +21,10 @@ import (
 	"bufio"
 	"context"
 	_ "embed"
+	"encoding/hex"
 	"fmt"
+	"io"
+	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
@@ -29,9 +32,11 @@ import (
 
 	"github.com/google/osv-scalibr/detector"
 	"github.com/google/osv-scalibr/detector/weakcredentials/winlocal/samreg"
+	"github.com/google/osv-scalibr/detector/weakcredentials/winlocal/securityreg"
 	"github.com/google/osv-scalibr/detector/weakcredentials/winlocal/systemreg"
 	scalibrfs "github.com/google/osv-scalibr/fs"
 	"github.com/google/osv-scalibr/inventoryindex"
+	"github.com/google/osv-scalibr/log"
 	"github.com/google/osv-scalibr/plugin"
 	"golang.org/x/sys/windows/registry"
 )
@@ -44,16 +49,81 @@ var (
 )
 
 const (
-	samDumpFile       = `C:\ProgramData\Scalibr\private\SAM`
-	systemDumpFile    = `C:\ProgramData\Scalibr\private\SYSTEM`
-	vulnRefLMPassword = "PASSWORD_HASH_LM_FORMAT"
-	vulnRefWeakPass   = "WINDOWS_WEAK_PASSWORD"
+	samDumpFile      = `C:\ProgramData\Scalibr\private\SAM`
+	systemDumpFile   = `C:\ProgramData\Scalibr\private\SYSTEM`
+	securityDumpFile = `C:\ProgramData\Scalibr\private\SECURITY`
+
+	vulnRefLMPassword           = "PASSWORD_HASH_LM_FORMAT"
+	vulnRefWeakPass             = "WINDOWS_WEAK_PASSWORD"
+	vulnRefPwnedPass            = "WINDOWS_PWNED_PASSWORD"
+	vulnRefWeakCachedDomainPass = "WINDOWS_WEAK_CACHED_DOMAIN_PASSWORD"
+	vulnRefLSASecret            = "WINDOWS_LSA_SECRET_PLAINTEXT_CREDENTIAL"
 )
 
 // Detector is a SCALIBR Detector for weak passwords detector for local accounts on Windows.
 type Detector struct {
-	knownNTHashes map[string]string
-	knownLMHashes map[string]string
+	// dictionaryFiles are paths to user-supplied plain wordlists (one candidate per line),
+	// loaded lazily alongside the embedded top-100 dictionaries.
+	dictionaryFiles []string
+	// dictionaryReaders are user-supplied plain wordlists provided directly as io.Readers,
+	// e.g. for callers that already have the wordlist in memory.
+	dictionaryReaders []io.Reader
+	// rules are applied to every candidate of the user-supplied wordlists before hashing; the
+	// embedded top-100 entries are used as they are. Defaults to DefaultRules if nil.
+	rules []Rule
+
+	// enableHIBPCheck, when set, additionally checks every recovered NT hash against the Have
+	// I Been Pwned Pwned-Passwords service via hibpClient.
+	enableHIBPCheck bool
+	// hibpClient is used to perform the HIBP lookups. Defaults to NewHTTPHIBPClient(http.DefaultClient)
+	// if enableHIBPCheck is set but no client was supplied.
+	hibpClient HIBPClient
+}
+
+// Option configures a Detector returned by New.
+type Option func(*Detector)
+
+// WithDictionaryFile adds a plain wordlist file (one candidate password per line) to the set of
+// dictionaries consulted during bruteforcing, in addition to the embedded top-100 hash lists.
+func WithDictionaryFile(path string) Option {
+	return func(d *Detector) {
+		d.dictionaryFiles = append(d.dictionaryFiles, path)
+	}
+}
+
+// WithDictionaryReader adds a plain wordlist (one candidate password per line) to the set of
+// dictionaries consulted during bruteforcing.
+func WithDictionaryReader(r io.Reader) Option {
+	return func(d *Detector) {
+		d.dictionaryReaders = append(d.dictionaryReaders, r)
+	}
+}
+
+// WithRules overrides the mangling rules applied to every dictionary candidate before hashing.
+// If not set, DefaultRules is used.
+func WithRules(rules []Rule) Option {
+	return func(d *Detector) {
+		d.rules = rules
+	}
+}
+
+// WithHIBPCheck enables checking every recovered NT hash against the Have I Been Pwned
+// Pwned-Passwords service, using client to perform the lookups. If client is nil, a default
+// client backed by http.DefaultClient is used.
+func WithHIBPCheck(client HIBPClient) Option {
+	return func(d *Detector) {
+		d.enableHIBPCheck = true
+		d.hibpClient = client
+	}
+}
+
+// New creates a Detector, applying the given options.
+func New(opts ...Option) *Detector {
+	d := &Detector{}
+	for _, opt := range opts {
+		opt(d)
+	}
+	return d
 }
 
 // userHashInfo contains the hashes of a user. Note that both hashes represents the same password.
@@ -114,6 +184,42 @@ func (d Detector) internalScan(ctx context.Context, hashes []*userHashInfo) ([]*
 		findings = append(findings, d.findingForWeakPasswords(weakUsers))
 	}
 
+	// next, recover cached domain logons (DCC2) and LSA secrets from the SECURITY hive.
+	cachedUsers, secrets, err := d.cachedCredentials(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(cachedUsers) > 0 {
+		weakCachedUsers, err := d.bruteforceDCC2(ctx, cachedUsers)
+		if err != nil {
+			return nil, err
+		}
+		if len(weakCachedUsers) > 0 {
+			findings = append(findings, d.findingForWeakCachedDomainPasswords(weakCachedUsers))
+		}
+	}
+
+	if nonEmptySecrets := filterNonEmptySecrets(secrets); len(nonEmptySecrets) > 0 {
+		findings = append(findings, d.findingForLSASecrets(nonEmptySecrets))
+	}
+
+	// finally, if enabled, check the NT hashes against HIBP. A failure to reach the service is a
+	// soft error: it should not abort the rest of the scan.
+	if d.enableHIBPCheck {
+		client := d.hibpClient
+		if client == nil {
+			client = NewHTTPHIBPClient(http.DefaultClient)
+		}
+
+		pwned, err := checkHIBP(ctx, client, hashes)
+		if err != nil {
+			log.Errorf("weakcredentials/winlocal: HIBP check failed, skipping: %v", err)
+		} else if len(pwned) > 0 {
+			findings = append(findings, d.findingForPwnedPasswords(pwned))
+		}
+	}
+
 	return findings, nil
 }
 
@@ -156,6 +262,27 @@ func (d Detector) findingForWeakPasswords(users map[string]string) *detector.Fin
 	}
 }
 
+// findingForPwnedPasswords creates a Scalibr finding when a user's NT hash was found in the HIBP
+// Pwned-Passwords dataset, even though the clear-text password itself is not known. users maps
+// username to the number of times the password has been seen in known breaches.
+func (d Detector) findingForPwnedPasswords(users map[string]int) *detector.Finding {
+	return &detector.Finding{
+		Adv: &detector.Advisory{
+			ID: &detector.AdvisoryID{
+				Publisher: "GOOGLE",
+				Reference: vulnRefPwnedPass,
+			},
+			Sev: &detector.Severity{
+				Severity: detector.SeverityHigh,
+			},
+			Type:           detector.TypeVulnerability,
+			Description:    "Some users' passwords were found in the Have I Been Pwned Pwned-Passwords dataset, meaning they have appeared in known data breaches.",
+			Recommendation: "Change the password of the affected users, even though the clear-text value could not be recovered locally.",
+		},
+		Extra: fmt.Sprintf("%v", users),
+	}
+}
+
 // saveSensitiveReg saves a registry key to a file. It handles registries that are considered
 // sensitive and thus will try to take measures to limit access to the file.
 // Note that it is still the responsibility of the caller to delete the file once it is no longer
@@ -218,15 +345,23 @@ func (d Detector) dumpSYSTEM(systemFile string) (*systemreg.SystemRegistry, erro
 	return reg, nil
 }
 
-// loadDictionary loads a dictionary (*in place*) of known passwords from a file.
-// Each line is expected to be in the format:
-//
-//	hash;clearPass
-func (d Detector) loadDictionary(file string, dict map[string]string) error {
-	if dict == nil {
-		return fmt.Errorf("dictionary is nil")
+func (d Detector) dumpSECURITY(securityFile string) (*securityreg.SecurityRegistry, error) {
+	if err := d.saveSensitiveReg(registry.LOCAL_MACHINE, `SECURITY`, securityFile); err != nil {
+		return nil, err
 	}
 
+	reg, err := securityreg.NewFromFile(securityFile)
+	if err != nil {
+		os.Remove(securityFile)
+		return nil, err
+	}
+
+	return reg, nil
+}
+
+// loadEmbeddedDictionary loads a dictionary of known hash;clearPass pairs (in the format the
+// embedded top-100 CSVs use) into hashTable, keyed by the raw hash bytes.
+func loadEmbeddedDictionary(file string, hashTable map[[16]byte]string) error {
 	scanner := bufio.NewScanner(strings.NewReader(file))
 	for scanner.Scan() {
 		line := scanner.Text()
@@ -235,30 +370,59 @@ func (d Detector) loadDictionary(file string, dict map[string]string) error {
 			continue
 		}
 
-		hash := parts[0]
-		clearPass := parts[1]
-		dict[hash] = clearPass
+		raw, err := hex.DecodeString(parts[0])
+		if err != nil || len(raw) != 16 {
+			continue
+		}
+
+		var key [16]byte
+		copy(key[:], raw)
+		if _, ok := hashTable[key]; !ok {
+			hashTable[key] = parts[1]
+		}
 	}
 
-	return nil
+	return scanner.Err()
 }
 
-func (d Detector) knownHashes() (map[string]string, map[string]string, error) {
-	if d.knownNTHashes == nil {
-		d.knownNTHashes = make(map[string]string)
-		if err := d.loadDictionary(knownNTHashesFile, d.knownNTHashes); err != nil {
-			return nil, nil, err
+// hashTable builds the merged dictionary of known passwords, keyed by raw NT/LM hash bytes. It
+// combines the embedded top-100 CSVs with every user-supplied wordlist, rule-expanding each
+// candidate before hashing. Using a single map[[16]byte]string rather than separate NT/LM
+// dictionaries keeps memory bounded and lets the bruteforce loop do a single merged lookup.
+func (d Detector) hashTable() (map[[16]byte]string, error) {
+	table := make(map[[16]byte]string)
+
+	if err := loadEmbeddedDictionary(knownNTHashesFile, table); err != nil {
+		return nil, fmt.Errorf("loading embedded NT hash dictionary: %w", err)
+	}
+	if err := loadEmbeddedDictionary(knownLMHashesFile, table); err != nil {
+		return nil, fmt.Errorf("loading embedded LM hash dictionary: %w", err)
+	}
+
+	rules := d.rules
+	if rules == nil {
+		rules = DefaultRules()
+	}
+
+	for _, path := range d.dictionaryFiles {
+		f, err := os.Open(path)
+		if err != nil {
+			return nil, fmt.Errorf("opening dictionary file %q: %w", path, err)
+		}
+		err = loadWordlist(f, rules, table)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("loading dictionary file %q: %w", path, err)
 		}
 	}
 
-	if d.knownLMHashes == nil {
-		d.knownLMHashes = make(map[string]string)
-		if err := d.loadDictionary(knownLMHashesFile, d.knownLMHashes); err != nil {
-			return nil, nil, err
+	for _, r := range d.dictionaryReaders {
+		if err := loadWordlist(r, rules, table); err != nil {
+			return nil, fmt.Errorf("loading dictionary: %w", err)
 		}
 	}
 
-	return d.knownNTHashes, d.knownLMHashes, nil
+	return table, nil
 }
 
 func (d Detector) hashesForUser(sam *samreg.SAMRegistry, rid string, derivedKey []byte) (*userHashInfo, error) {
@@ -349,8 +513,111 @@ func (d Detector) hashes(ctx context.Context) ([]*userHashInfo, error) {
 	return users, nil
 }
 
+// cachedCredentials dumps the SECURITY hive and, using the SYSTEM boot key, decrypts the cached
+// domain logon (DCC2) verifiers and LSA secrets it protects.
+func (d Detector) cachedCredentials(ctx context.Context) ([]*securityreg.CachedDomainUser, map[string][]byte, error) {
+	system, err := d.dumpSYSTEM(systemDumpFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer os.Remove(systemDumpFile)
+	defer system.Close()
+
+	bootKey, err := system.Syskey()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	security, err := d.dumpSECURITY(securityDumpFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer os.Remove(securityDumpFile)
+	defer security.Close()
+
+	if err := ctx.Err(); err != nil {
+		return nil, nil, err
+	}
+
+	lsaKey, err := security.DeriveLSAKey(bootKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cachedUsers, err := security.CachedDomainUsers(lsaKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	secrets, err := security.Secrets(lsaKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return cachedUsers, secrets, nil
+}
+
+// findingForWeakCachedDomainPasswords creates a Scalibr finding when a cached domain logon's
+// DCC2 verifier was cracked against the configured dictionaries. users maps "DOMAIN\username" to
+// the recovered cleartext password.
+func (d Detector) findingForWeakCachedDomainPasswords(users map[string]string) *detector.Finding {
+	return &detector.Finding{
+		Adv: &detector.Advisory{
+			ID: &detector.AdvisoryID{
+				Publisher: "GOOGLE",
+				Reference: vulnRefWeakCachedDomainPass,
+			},
+			Sev: &detector.Severity{
+				Severity: detector.SeverityCritical,
+			},
+			Type:           detector.TypeVulnerability,
+			Description:    "Some cached domain logon credentials (DCC2) were identified as weak.",
+			Recommendation: "Change the password of the affected domain users.",
+		},
+		Extra: fmt.Sprintf("%v", users),
+	}
+}
+
+// filterNonEmptySecrets drops LSA secrets that decrypted to an empty value, since their mere
+// absence carries no credential-exposure risk.
+func filterNonEmptySecrets(secrets map[string][]byte) map[string][]byte {
+	nonEmpty := make(map[string][]byte)
+	for name, value := range secrets {
+		if len(value) > 0 {
+			nonEmpty[name] = value
+		}
+	}
+	return nonEmpty
+}
+
+// findingForLSASecrets creates a single Scalibr finding listing the names of every non-empty LSA
+// secret recovered from the SECURITY hive. Its mere presence is a credential-exposure risk regardless of strength, so
+// this fires whenever a secret decrypts to a non-empty value.
+func (d Detector) findingForLSASecrets(secrets map[string][]byte) *detector.Finding {
+	names := make([]string, 0, len(secrets))
+	for name := range secrets {
+		names = append(names, name)
+	}
+
+	return &detector.Finding{
+		Adv: &detector.Advisory{
+			ID: &detector.AdvisoryID{
+				Publisher: "GOOGLE",
+				Reference: vulnRefLSASecret,
+			},
+			Sev: &detector.Severity{
+				Severity: detector.SeverityCritical,
+			},
+			Type:           detector.TypeVulnerability,
+			Description:    "LSA secrets with non-empty values were recovered from the SECURITY hive. These often contain service account passwords, autologon credentials, or the machine account password.",
+			Recommendation: "Rotate the affected credentials and restrict access to the LSA secrets store.",
+		},
+		Extra: fmt.Sprintf("%v", names),
+	}
+}
+
 func (d Detector) bruteforce(ctx context.Context, hashes []*userHashInfo) (map[string]string, error) {
-	knownNTHashes, knownLMHashes, err := d.knownHashes()
+	table, err := d.hashTable()
 	if err != nil {
 		return nil, err
 	}
@@ -362,15 +629,15 @@ func (d Detector) bruteforce(ctx context.Context, hashes []*userHashInfo) (map[s
 			return nil, err
 		}
 
-		if len(user.lmHash) > 0 {
-			if password, ok := knownLMHashes[user.lmHash]; ok {
+		if key, ok := hexToHashKey(user.lmHash); ok {
+			if password, ok := table[key]; ok {
 				results[user.username] = password
 				continue
 			}
 		}
 
-		if len(user.ntHash) > 0 {
-			if password, ok := knownNTHashes[user.ntHash]; ok {
+		if key, ok := hexToHashKey(user.ntHash); ok {
+			if password, ok := table[key]; ok {
 				results[user.username] = password
 				continue
 			}
@@ -378,4 +645,21 @@ func (d Detector) bruteforce(ctx context.Context, hashes []*userHashInfo) (map[s
 	}
 
 	return results, nil
+}
+
+// hexToHashKey decodes a hex-encoded hash (as produced by hashesForUser) into the raw [16]byte
+// key used by the merged hash table.
+func hexToHashKey(hexHash string) ([16]byte, bool) {
+	var key [16]byte
+	if hexHash == "" {
+		return key, false
+	}
+
+	raw, err := hex.DecodeString(hexHash)
+	if err != nil || len(raw) != 16 {
+		return key, false
+	}
+
+	copy(key[:], raw)
+	return key, true
 }
\ No newline at end of file
@@ -0,0 +1,151 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package extractor defines the Inventory type extractors produce and the Extractor interface
+// they implement, shared by every extraction mechanism (filesystem walks, container layer
+// scanning, etc).
+package extractor
+
+import "fmt"
+
+// PackageURL is a minimal Package URL (https://github.com/package-url/purl-spec) representation,
+// just precise enough to key inventory for diffing and origin tracing.
+type PackageURL struct {
+	Type      string
+	Namespace string
+	Name      string
+	Version   string
+}
+
+// String renders p in "pkg:type/namespace/name@version" form, omitting empty components.
+func (p *PackageURL) String() string {
+	if p == nil {
+		return ""
+	}
+
+	name := p.Name
+	if p.Namespace != "" {
+		name = p.Namespace + "/" + name
+	}
+
+	s := fmt.Sprintf("pkg:%s/%s", p.Type, name)
+	if p.Version != "" {
+		s += "@" + p.Version
+	}
+	return s
+}
+
+// Extractor turns file content found by a scan into Inventory. Concrete extractors (e.g. the
+// filesystem.Extractor implementations under extractor/filesystem) embed or satisfy this
+// interface alongside their own Extract method.
+type Extractor interface {
+	// Name uniquely identifies this extractor, e.g. "python/wheelegg".
+	Name() string
+	// Version is the extractor's implementation version, bumped when its output format or
+	// semantics change in a way downstream consumers may care about.
+	Version() int
+	// Ecosystem returns the OSV ecosystem the inventory belongs to (e.g. "PyPI"), used as a
+	// fallback dedup key when ToPURL can't produce one.
+	Ecosystem(inv *Inventory) string
+	// ToPURL returns the Package URL for inv, or nil if this extractor's packages can't be
+	// represented as one.
+	ToPURL(inv *Inventory) *PackageURL
+}
+
+// Annotation is a note about how an Inventory item was found or should be treated, independent
+// of its identity (e.g. whether it was found inside another package's private store).
+type Annotation string
+
+// LayerDetails describes the OCI layer an Inventory item was introduced by, as populated by the
+// artifact/image/layerscanning/trace package.
+type LayerDetails struct {
+	// Index is the 0-based position of the layer within the image's chain layers, oldest first.
+	Index int
+	// DiffID is the layer's content hash.
+	DiffID string
+	// Command is the build-history command that produced the layer (e.g. a Dockerfile RUN line),
+	// if known.
+	Command string
+	// InBaseImage reports whether this layer falls within a matched base image prefix.
+	InBaseImage bool
+	// BaseImageRef is the human-readable reference for the matched base image (e.g.
+	// "alpine:3.19"), set only when InBaseImage is true.
+	BaseImageRef string
+	// DockerfilePath is the path of the Dockerfile this layer was correlated to, if any.
+	DockerfilePath string
+	// DockerfileLine is the 1-indexed line of DockerfilePath that produced this layer.
+	DockerfileLine int
+	// Instruction is the Dockerfile instruction keyword (e.g. "RUN", "COPY") that produced this
+	// layer.
+	Instruction string
+	// Deleted reports whether this LayerDetails describes a tombstone: a package that was present
+	// starting at Index but was later removed or overwritten.
+	Deleted bool
+	// DeletedInLayer is set when Deleted is true, and describes the layer where the package was
+	// found to be missing.
+	DeletedInLayer *LayerDetails
+}
+
+// InventoryKey identifies the same logical package across layers or scans, for deduplication and
+// lookup purposes.
+type InventoryKey struct {
+	// PURL is the package's Package URL string, or a name|ecosystem fallback when no PURL can be
+	// computed, with "@version" appended when the version is set (see Inventory.ToKey).
+	PURL string
+	// Path is the first location the package was found at.
+	Path string
+}
+
+// Inventory is a single piece of software (typically a package) found by an Extractor.
+type Inventory struct {
+	// Name is the package name.
+	Name string
+	// Version is the package version, in whatever form the originating ecosystem uses.
+	Version string
+	// SourceCode identifies the source-controlled location the package was built from, if known.
+	SourceCode string
+	// Locations is the set of file paths (relative to the scan root) that contributed to this
+	// Inventory item.
+	Locations []string
+	// Extractor is the Extractor that produced this item.
+	Extractor Extractor
+	// Annotations are extra notes about how this item was found.
+	Annotations []Annotation
+	// LayerDetails is the origin layer information populated by the trace package, if any.
+	LayerDetails *LayerDetails
+}
+
+// ToKey returns the InventoryKey for inv: its PURL (or a name|ecosystem fallback), with the
+// version appended when set, paired with the first of its Locations. This is distinct from
+// Extractor.ToPURL itself, which never embeds the version so that e.g. the diff package can match
+// the same package across a version change; ToKey needs the version to disambiguate the exact
+// artifact being traced.
+func (i *Inventory) ToKey() (InventoryKey, error) {
+	purl := ""
+	if p := i.Extractor.ToPURL(i); p != nil {
+		purl = p.String()
+	} else {
+		purl = fmt.Sprintf("%s|%s", i.Name, i.Extractor.Ecosystem(i))
+	}
+	if i.Version != "" {
+		purl += "@" + i.Version
+	}
+
+	path := ""
+	if len(i.Locations) > 0 {
+		path = i.Locations[0]
+	}
+
+	return InventoryKey{PURL: purl, Path: path}, nil
+}
@@ -0,0 +1,323 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package filesystem runs a set of Extractors over one or more filesystem scan roots, either by
+// walking every file or by targeting a fixed list of paths, and aggregates their results.
+package filesystem
+
+import (
+	"context"
+	"io/fs"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/google/osv-scalibr/artifact/image/contentcache"
+	"github.com/google/osv-scalibr/extractor"
+	scalibrfs "github.com/google/osv-scalibr/fs"
+	scalibrImage "github.com/google/osv-scalibr/artifact/image"
+	"github.com/google/osv-scalibr/stats"
+)
+
+// ScanInput is what gets handed to an Extractor.Extract call for a single file.
+type ScanInput struct {
+	// FS is the filesystem the file was found on.
+	FS scalibrfs.FS
+	// Path is the file's path relative to FS.
+	Path string
+	// Info is the file's fs.FileInfo, as returned by FS.Stat.
+	Info fs.FileInfo
+	// Reader opens the file's content. Extractors should not assume it has been read from yet,
+	// and should not close it (the caller does).
+	Reader fs.File
+}
+
+// Extractor finds and parses inventory from files on a filesystem.
+type Extractor interface {
+	extractor.Extractor
+	// FileRequired reports whether this extractor wants to run against path.
+	FileRequired(path string, fileinfo fs.FileInfo) bool
+	// Extract parses inventory out of the file described by input.
+	Extract(ctx context.Context, input *ScanInput) ([]*extractor.Inventory, error)
+}
+
+// BaseImageMatcher identifies the prefix of a chain layer list that corresponds to a known base
+// image (e.g. Alpine, Debian, distroless, UBI), so vulnerabilities inherited from the base can be
+// distinguished from ones introduced by the image's own build steps. Defined here (rather than in
+// the layerscanning/trace package that implements it) so Config can reference it without a
+// package import cycle; see trace.BaseImageMatcher, which is this type.
+type BaseImageMatcher interface {
+	// Match inspects chainLayers (oldest first) and returns the number of leading layers that
+	// match a known base image, and a human-readable reference for that base (e.g.
+	// "alpine:3.19"). A prefixLen of 0 means no known base was matched.
+	Match(chainLayers []scalibrImage.ChainLayer) (prefixLen int, ref string)
+}
+
+// DockerfileCorrelation is the Dockerfile source location attributed to one chain layer. Defined
+// here for the same import-cycle reason as BaseImageMatcher; see trace.DockerfileCorrelation,
+// which is this type.
+type DockerfileCorrelation struct {
+	DockerfilePath string
+	DockerfileLine int
+	Instruction    string
+}
+
+// Config configures a single run of Extractors over a set of scan roots.
+type Config struct {
+	// Stats receives instrumentation events for this run. It has no default: Run calls it
+	// directly, so it must be set (e.g. to stats.NoopCollector{}).
+	Stats stats.Collector
+	// Extractors is the set of extractors to run.
+	Extractors []Extractor
+	// ScanRoots is the set of filesystems to scan.
+	ScanRoots []*scalibrfs.ScanRoot
+	// FilesToExtract, when non-empty, restricts the scan to exactly these paths (checked against
+	// each extractor's FileRequired) instead of walking every file under ScanRoots. Used by the
+	// layerscanning/trace package to target just the locations an inventory item is known to
+	// live at, rather than re-walking an entire layer's filesystem.
+	FilesToExtract []string
+	// DirsToSkip is a set of directory paths (relative to a scan root) to not descend into.
+	DirsToSkip []string
+	// SkipDirRegex, if set, additionally skips directories whose path matches it.
+	SkipDirRegex *regexp.Regexp
+	// SkipDirGlob, if set, additionally skips directories whose path matches this glob pattern.
+	SkipDirGlob string
+	// MaxInodes caps how many filesystem entries a single scan root walk will visit before
+	// giving up. Zero means unlimited.
+	MaxInodes int
+	// ReadSymlinks, if set, follows symlinks encountered during the walk instead of skipping them.
+	ReadSymlinks bool
+	// StoreAbsolutePath, if set, reports ScanInput.Path joined with the scan root's real on-disk
+	// Path (when set), instead of the path relative to the scan root's FS.
+	StoreAbsolutePath bool
+	// PrintDurationAnalysis, if set, records the wall-clock duration of the run in the returned
+	// ScanStats.
+	PrintDurationAnalysis bool
+
+	// The fields below are consumed by the layerscanning/trace package rather than by Run itself;
+	// they live on Config because that's the type trace.ResolveOriginLayer and
+	// trace.ResolveDeletedPackages take, so layer-scanning-specific knobs travel alongside the
+	// generic extraction ones instead of needing a second config type threaded everywhere.
+
+	// CacheManager, when set, lets layer-scanning reuse a prior extraction result for a file
+	// whose content digest is unchanged from a previously-scanned layer, instead of re-running
+	// extractors against it. See artifact/image/contentcache.
+	CacheManager *contentcache.Manager
+	// TraceDeleted enables ResolveDeletedPackages' full per-layer extraction pass, additionally
+	// reporting packages that were installed and then removed or overwritten by a later layer.
+	TraceDeleted bool
+	// BaseImageMatcher, when set, lets ResolveOriginLayer populate LayerDetails.InBaseImage and
+	// LayerDetails.BaseImageRef for layers within a recognized base image.
+	BaseImageMatcher BaseImageMatcher
+	// TraceConcurrency bounds how many inventory groups ResolveOriginLayerStream traces at once.
+	// Values less than 1 mean no concurrency (one group at a time).
+	TraceConcurrency int
+	// DockerfileCorrelation, when set, lets ResolveOriginLayer populate LayerDetails.DockerfilePath,
+	// LayerDetails.DockerfileLine and LayerDetails.Instruction for layers it covers. Built by
+	// trace.CorrelateDockerfile.
+	DockerfileCorrelation map[int]*DockerfileCorrelation
+}
+
+// ScanStats summarizes a single Run call.
+type ScanStats struct {
+	// FilesVisited is how many filesystem entries the walk considered.
+	FilesVisited int
+	// FilesExtracted is how many files at least one extractor ran against.
+	FilesExtracted int
+	// Runtime is the wall-clock duration of the run, set only when Config.PrintDurationAnalysis
+	// is true.
+	Runtime time.Duration
+}
+
+// Run runs every extractor in config.Extractors against config.ScanRoots and returns the
+// aggregated inventory.
+func Run(ctx context.Context, config *Config) ([]*extractor.Inventory, *ScanStats, error) {
+	start := time.Now()
+	result := &ScanStats{}
+
+	var inventory []*extractor.Inventory
+	for _, root := range config.ScanRoots {
+		if err := ctx.Err(); err != nil {
+			return nil, nil, err
+		}
+
+		var invs []*extractor.Inventory
+		var err error
+		if len(config.FilesToExtract) > 0 {
+			invs, err = runFixedPaths(ctx, config, root, result)
+		} else {
+			invs, err = runWalk(ctx, config, root, result)
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		inventory = append(inventory, invs...)
+	}
+
+	if config.PrintDurationAnalysis {
+		result.Runtime = time.Since(start)
+	}
+
+	return inventory, result, nil
+}
+
+// runFixedPaths extracts only from config.FilesToExtract, skipping paths that don't exist in
+// root rather than treating that as an error (a common and expected case when probing whether a
+// package's locations are present in an older image layer).
+func runFixedPaths(ctx context.Context, config *Config, root *scalibrfs.ScanRoot, result *ScanStats) ([]*extractor.Inventory, error) {
+	var inventory []*extractor.Inventory
+
+	for _, p := range config.FilesToExtract {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		clean := cleanRelPath(p)
+		info, err := fs.Stat(root.FS, clean)
+		if err != nil {
+			continue
+		}
+		result.FilesVisited++
+
+		invs, err := extractFile(ctx, config, root, clean, info, result)
+		if err != nil {
+			return nil, err
+		}
+		inventory = append(inventory, invs...)
+	}
+
+	return inventory, nil
+}
+
+// runWalk walks every file under root and extracts from the ones an extractor wants.
+func runWalk(ctx context.Context, config *Config, root *scalibrfs.ScanRoot, result *ScanStats) ([]*extractor.Inventory, error) {
+	var inventory []*extractor.Inventory
+	visited := 0
+
+	err := fs.WalkDir(root.FS, ".", func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if ctxErr := ctx.Err(); ctxErr != nil {
+			return ctxErr
+		}
+
+		if d.IsDir() {
+			if p != "." && shouldSkipDir(p, config) {
+				return fs.SkipDir
+			}
+			return nil
+		}
+
+		if config.MaxInodes > 0 && visited >= config.MaxInodes {
+			return fs.SkipAll
+		}
+		visited++
+
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+
+		config.Stats.AfterInodeVisited(stats.AfterInodeVisitedStats{Path: p})
+		result.FilesVisited++
+
+		invs, err := extractFile(ctx, config, root, p, info, result)
+		if err != nil {
+			return err
+		}
+		inventory = append(inventory, invs...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return inventory, nil
+}
+
+// shouldSkipDir reports whether p should be skipped per config's DirsToSkip/SkipDirRegex/SkipDirGlob.
+func shouldSkipDir(p string, config *Config) bool {
+	clean := cleanRelPath(p)
+	for _, skip := range config.DirsToSkip {
+		if clean == cleanRelPath(skip) {
+			return true
+		}
+	}
+	if config.SkipDirRegex != nil && config.SkipDirRegex.MatchString(clean) {
+		return true
+	}
+	if config.SkipDirGlob != "" {
+		if ok, err := path.Match(config.SkipDirGlob, clean); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
+
+// extractFile runs every extractor in config.Extractors that wants p against it.
+func extractFile(ctx context.Context, config *Config, root *scalibrfs.ScanRoot, p string, info fs.FileInfo, result *ScanStats) ([]*extractor.Inventory, error) {
+	var inventory []*extractor.Inventory
+	extracted := false
+
+	for _, ext := range config.Extractors {
+		if !ext.FileRequired(p, info) {
+			continue
+		}
+
+		f, err := root.FS.Open(p)
+		if err != nil {
+			continue
+		}
+
+		reportPath := p
+		if config.StoreAbsolutePath && root.Path != "" {
+			reportPath = path.Join(root.Path, p)
+		}
+
+		invs, err := ext.Extract(ctx, &ScanInput{FS: root.FS, Path: reportPath, Info: info, Reader: f})
+		closeErr := f.Close()
+
+		runErr := err
+		if runErr == nil {
+			runErr = closeErr
+		}
+		config.Stats.AfterExtractorRun(stats.AfterExtractorRunStats{Extractor: ext.Name(), Error: runErr})
+		if err != nil {
+			return nil, err
+		}
+		if closeErr != nil {
+			return nil, closeErr
+		}
+
+		extracted = true
+		inventory = append(inventory, invs...)
+	}
+
+	if extracted {
+		result.FilesExtracted++
+	}
+
+	return inventory, nil
+}
+
+// cleanRelPath normalizes p into the form io/fs expects: no leading slash, "." for the root.
+func cleanRelPath(p string) string {
+	p = strings.TrimPrefix(p, "/")
+	if p == "" {
+		return "."
+	}
+	return path.Clean(p)
+}
@@ -0,0 +1,38 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fs defines the filesystem abstraction scan roots and extractors are built against, so
+// the same scanning code can run over a real OS filesystem, a mounted image layer, or an
+// in-memory fixture.
+package fs
+
+import "io/fs"
+
+// FS is the filesystem abstraction extractors and the filesystem walker operate on. It is
+// satisfied by os.DirFS, io/fs.FS implementations backed by a container layer, or test fakes.
+type FS interface {
+	fs.FS
+	fs.StatFS
+	fs.ReadDirFS
+}
+
+// ScanRoot is a single filesystem to scan, optionally rooted at a real on-disk path (used to
+// resolve absolute paths for reporting) in addition to the abstract FS used to actually read it.
+type ScanRoot struct {
+	// FS is the filesystem to scan.
+	FS FS
+	// Path is the real on-disk path FS is rooted at, if any. Empty for purely virtual roots (e.g.
+	// a container layer that was never extracted to disk).
+	Path string
+}
@@ -0,0 +1,62 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package stats provides instrumentation hooks for observing scan internals (e.g. filesystem
+// walks, extractor runs) without coupling the scan packages to any particular metrics backend.
+package stats
+
+import "time"
+
+// FileExtractedStats describes the outcome of running a single extractor against a single file.
+type FileExtractedStats struct {
+	Path          string
+	Extractor     string
+	Result        error
+	FileSizeBytes int64
+	UncompressDir string
+}
+
+// AfterExtractorRunStats describes the outcome of running a single extractor against a single
+// file during a scan.
+type AfterExtractorRunStats struct {
+	Extractor string
+	Error     error
+	Runtime   time.Duration
+}
+
+// AfterInodeVisitedStats describes a single filesystem entry visited during a walk.
+type AfterInodeVisitedStats struct {
+	Path string
+}
+
+// Collector receives instrumentation events emitted while scanning a filesystem. Every method
+// may be called concurrently.
+type Collector interface {
+	AfterInodeVisited(stats AfterInodeVisitedStats)
+	AfterExtractorRun(stats AfterExtractorRunStats)
+	AfterFileExtracted(stats FileExtractedStats)
+}
+
+// NoopCollector is a Collector that discards every event, for callers that don't care about
+// instrumentation.
+type NoopCollector struct{}
+
+// AfterInodeVisited implements Collector.
+func (NoopCollector) AfterInodeVisited(stats AfterInodeVisitedStats) {}
+
+// AfterExtractorRun implements Collector.
+func (NoopCollector) AfterExtractorRun(stats AfterExtractorRunStats) {}
+
+// AfterFileExtracted implements Collector.
+func (NoopCollector) AfterFileExtracted(stats FileExtractedStats) {}
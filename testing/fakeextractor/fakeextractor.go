@@ -0,0 +1,94 @@
+// Copyright 2024 Google LLC
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package fakeextractor provides a filesystem.Extractor fake for tests, which reports a fixed set
+// of inventory names for a fixed set of paths without reading any real package manifest format.
+package fakeextractor
+
+import (
+	"context"
+	"io/fs"
+
+	"github.com/google/osv-scalibr/extractor"
+	"github.com/google/osv-scalibr/extractor/filesystem"
+)
+
+// NamesErr is the canned result for one path: either the inventory names it produces, or an
+// error, not both.
+type NamesErr struct {
+	Names []string
+	Err   error
+}
+
+// Extractor is a fake filesystem.Extractor whose FileRequired/Extract behavior is entirely
+// determined by the paths and results passed to New.
+type Extractor struct {
+	name    string
+	version int
+	files   map[string]bool
+	results map[string]NamesErr
+}
+
+// New returns a fake Extractor named name that requires exactly the paths in files, and whose
+// Extract calls return the names (or error) recorded in results for the path being extracted.
+// A path present in files but absent from results produces no inventory and no error.
+func New(name string, version int, files []string, results map[string]NamesErr) *Extractor {
+	fileSet := make(map[string]bool, len(files))
+	for _, f := range files {
+		fileSet[f] = true
+	}
+	return &Extractor{name: name, version: version, files: fileSet, results: results}
+}
+
+// Name implements extractor.Extractor.
+func (e *Extractor) Name() string { return e.name }
+
+// Version implements extractor.Extractor.
+func (e *Extractor) Version() int { return e.version }
+
+// Ecosystem implements extractor.Extractor. Fake inventory is always reported as pkg:pypi/<name>
+// so tests can rely on a fixed, predictable PURL.
+func (e *Extractor) Ecosystem(inv *extractor.Inventory) string { return "PyPI" }
+
+// ToPURL implements extractor.Extractor, deliberately never including the version: callers that
+// need to match the same logical package across versions (e.g. the diff package) rely on that.
+func (e *Extractor) ToPURL(inv *extractor.Inventory) *extractor.PackageURL {
+	return &extractor.PackageURL{Type: "pypi", Name: inv.Name}
+}
+
+// FileRequired implements filesystem.Extractor.
+func (e *Extractor) FileRequired(path string, fileinfo fs.FileInfo) bool {
+	return e.files[path]
+}
+
+// Extract implements filesystem.Extractor.
+func (e *Extractor) Extract(ctx context.Context, input *filesystem.ScanInput) ([]*extractor.Inventory, error) {
+	ne, ok := e.results[input.Path]
+	if !ok {
+		return nil, nil
+	}
+	if ne.Err != nil {
+		return nil, ne.Err
+	}
+
+	inv := make([]*extractor.Inventory, 0, len(ne.Names))
+	for _, name := range ne.Names {
+		inv = append(inv, &extractor.Inventory{
+			Name:      name,
+			Locations: []string{input.Path},
+			Extractor: e,
+		})
+	}
+	return inv, nil
+}